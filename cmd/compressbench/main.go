@@ -0,0 +1,276 @@
+// Command compressbench compresses a corpus with every Order and level through
+// the pools of package compress, and reports the compression ratio, the
+// compress and decompress speeds and the allocations of each, to pick levels
+// for one's own content.
+//
+// Usage:
+//
+//	compressbench [-orders gzip,br,zstd] [-levels fast,best,6] [-n 3] [-json] path...
+//
+// A path is a file or a directory, whose regular files are all read. Without
+// -levels every level of each codec is run, the levels are either portable
+// level names or native levels. The ratio is the uncompressed size over the
+// compressed one, higher is better. Speeds are in MB/s of uncompressed data,
+// over the best of n runs. Allocations are counted per file and exclude the
+// construction of the pooled encoders, which happens in a warm-up run.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/newacorn/goutils/compress"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type codec struct {
+	order compress.Order
+	// levels the native levels run without -levels.
+	levels []int
+}
+
+var codecs = []codec{
+	{compress.Gzip, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+	{compress.Deflate, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+	{compress.Zstd, []int{1, 2, 3, 4}},
+	{compress.Br, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+	{compress.Snappy, []int{1, 2, 3}},
+	{compress.S2, []int{1, 2, 3}},
+}
+
+type result struct {
+	Order            compress.Order `json:"order"`
+	Level            int            `json:"level"`
+	In               int64          `json:"in"`
+	Out              int64          `json:"out"`
+	Ratio            float64        `json:"ratio"`
+	CompressMBs      float64        `json:"compress_mb_s"`
+	DecompressMBs    float64        `json:"decompress_mb_s"`
+	CompressAllocs   float64        `json:"compress_allocs"`
+	DecompressAllocs float64        `json:"decompress_allocs"`
+}
+
+func main() {
+	orderList := flag.String("orders", "gzip,deflate,zstd,br,snappy,s2", "comma separated codecs")
+	levelList := flag.String("levels", "", "comma separated levels, all levels of each codec when empty")
+	runs := flag.Int("n", 3, "timed runs, the best one is reported")
+	asJSON := flag.Bool("json", false, "print JSON instead of a table")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "usage: compressbench [flags] path...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	b, err := newBench(*orderList, *levelList, *runs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	corpus, err := loadCorpus(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(corpus) == 0 {
+		log.Fatal("no files in the corpus")
+	}
+	results, err := b.run(corpus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *asJSON {
+		err = writeJSON(os.Stdout, results)
+	} else {
+		err = writeTable(os.Stdout, results)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type bench struct {
+	orders []compress.Order
+	// levels nil for the levels of each codec.
+	levels []compress.PortableLevel
+	runs   int
+}
+
+func newBench(orderList, levelList string, runs int) (*bench, error) {
+	b := &bench{runs: max(runs, 1)}
+	for _, name := range strings.Split(orderList, ",") {
+		name = strings.TrimSpace(name)
+		i := slices.IndexFunc(codecs, func(c codec) bool {
+			return string(c.order) == name
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("unknown codec %q", name)
+		}
+		b.orders = append(b.orders, codecs[i].order)
+	}
+	if levelList == "" {
+		return b, nil
+	}
+	for _, s := range strings.Split(levelList, ",") {
+		l, err := compress.ParsePortableLevel(s)
+		if err != nil {
+			return nil, fmt.Errorf("level %q: %w", s, err)
+		}
+		b.levels = append(b.levels, l)
+	}
+	return b, nil
+}
+
+// nativeLevels the distinct levels of order to run.
+func (b *bench) nativeLevels(order compress.Order) (levels []int) {
+	if b.levels == nil {
+		for _, c := range codecs {
+			if c.order == order {
+				return c.levels
+			}
+		}
+	}
+	for _, l := range b.levels {
+		if n := l.Native(order); !slices.Contains(levels, n) {
+			levels = append(levels, n)
+		}
+	}
+	return
+}
+
+func (b *bench) run(corpus [][]byte) (results []result, err error) {
+	for _, order := range b.orders {
+		for _, level := range b.nativeLevels(order) {
+			r, err := b.measure(corpus, order, level)
+			if err != nil {
+				return nil, fmt.Errorf("%s level %d: %w", order, level, err)
+			}
+			results = append(results, r)
+		}
+	}
+	return
+}
+
+// measure compresses and decompresses the corpus once to warm the pools and
+// check the round trip, then b.runs times for the figures.
+func (b *bench) measure(corpus [][]byte, order compress.Order, level int) (r result, err error) {
+	r = result{Order: order, Level: level}
+	compressed := make([][]byte, len(corpus))
+	var buf []byte
+	for i, src := range corpus {
+		if compressed[i], err = compress.AppendCompressed(nil, src, order, level); err != nil {
+			return
+		}
+		if buf, err = compress.AppendDecompressed(buf[:0], compressed[i], order, 0); err != nil {
+			return
+		}
+		if string(buf) != string(src) {
+			return r, fmt.Errorf("round trip mismatch")
+		}
+		r.In += int64(len(src))
+		r.Out += int64(len(compressed[i]))
+	}
+	if r.Out > 0 {
+		r.Ratio = float64(r.In) / float64(r.Out)
+	}
+	cTime, cAllocs, err := b.timed(corpus, func(i int) (err error) {
+		buf, err = compress.AppendCompressed(buf[:0], corpus[i], order, level)
+		return
+	})
+	if err != nil {
+		return
+	}
+	dTime, dAllocs, err := b.timed(corpus, func(i int) (err error) {
+		buf, err = compress.AppendDecompressed(buf[:0], compressed[i], order, 0)
+		return
+	})
+	if err != nil {
+		return
+	}
+	r.CompressMBs = mbs(r.In, cTime)
+	r.DecompressMBs = mbs(r.In, dTime)
+	r.CompressAllocs = cAllocs
+	r.DecompressAllocs = dAllocs
+	return
+}
+
+// timed calls fn for every file, b.runs times. best is the fastest run,
+// allocs the mean allocations per call.
+func (b *bench) timed(corpus [][]byte, fn func(i int) error) (best time.Duration, allocs float64, err error) {
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	mallocs := ms.Mallocs
+	for run := 0; run < b.runs; run++ {
+		start := time.Now()
+		for i := range corpus {
+			if err = fn(i); err != nil {
+				return
+			}
+		}
+		if d := time.Since(start); run == 0 || d < best {
+			best = d
+		}
+	}
+	runtime.ReadMemStats(&ms)
+	allocs = float64(ms.Mallocs-mallocs) / float64(b.runs*len(corpus))
+	return
+}
+
+func mbs(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / 1e6 / d.Seconds()
+}
+
+// loadCorpus reads the files of paths, directories are walked.
+func loadCorpus(paths []string) (corpus [][]byte, err error) {
+	for _, path := range paths {
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if len(data) > 0 {
+				corpus = append(corpus, data)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func writeTable(w io.Writer, results []result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(tw, "order\tlevel\tratio\tcompress MB/s\tdecompress MB/s\tallocs c/d\t")
+	for _, r := range results {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%.3f\t%.1f\t%.1f\t%.1f/%.1f\t\n",
+			r.Order, r.Level, r.Ratio, r.CompressMBs, r.DecompressMBs, r.CompressAllocs, r.DecompressAllocs)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, results []result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
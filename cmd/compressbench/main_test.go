@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/goutils/compress"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoErr(t, os.WriteFile(filepath.Join(dir, "a.json"), []byte(strings.Repeat(`{"id":1,"name":"row"},`, 1000)), 0o644))
+	assert.NoErr(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	assert.NoErr(t, os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte(strings.Repeat("plain text line\n", 800)), 0o644))
+	assert.NoErr(t, os.WriteFile(filepath.Join(dir, "empty"), nil, 0o644))
+	corpus, err := loadCorpus([]string{dir})
+	assert.NoErr(t, err)
+	assert.Len(t, corpus, 2)
+	//
+	b, err := newBench("gzip,zstd,s2", "fastest,fast,9", 1)
+	assert.NoErr(t, err)
+	assert.Eq(t, []int{1, 3, 9}, b.nativeLevels(compress.Gzip))
+	// fastest and fast are the same zstd level.
+	assert.Eq(t, []int{1, 9}, b.nativeLevels(compress.Zstd))
+	results, err := b.run(corpus)
+	assert.NoErr(t, err)
+	assert.Len(t, results, 7)
+	for _, r := range results {
+		assert.Eq(t, int64(len(corpus[0])+len(corpus[1])), r.In)
+		assert.Gt(t, r.Ratio, 5.0)
+		assert.Gt(t, r.CompressMBs, 0.0)
+		assert.Gt(t, r.DecompressMBs, 0.0)
+	}
+	//
+	buf := bytes.Buffer{}
+	assert.NoErr(t, writeTable(&buf, results))
+	assert.Eq(t, 8, strings.Count(buf.String(), "\n"))
+	assert.Contains(t, buf.String(), "decompress MB/s")
+	buf.Reset()
+	assert.NoErr(t, writeJSON(&buf, results))
+	var decoded []result
+	assert.NoErr(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Eq(t, results, decoded)
+	//
+	b, err = newBench("br", "", 1)
+	assert.NoErr(t, err)
+	assert.Len(t, b.nativeLevels(compress.Br), 12)
+	_, err = newBench("lzw", "", 1)
+	assert.Err(t, err)
+	_, err = newBench("gzip", "fastest,turbo", 1)
+	assert.ErrIs(t, err, compress.ErrInvalidLevel)
+}
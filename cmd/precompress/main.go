@@ -0,0 +1,274 @@
+// Command precompress writes .gz, .br and .zst siblings next to every
+// compressible file of a directory tree, for servers that serve precompressed
+// static files.
+//
+// Usage:
+//
+//	precompress [-j n] [-formats gz,br,zst] [-force] [-v] dir...
+//
+// A file is compressible when the content type of its extension passes
+// compress.CheckMimeOk. Outputs not smaller than the original are not kept and
+// are listed in a .precompress-skip file at the root of the directory, with the
+// mtime and size of their source, they are not tried again until the source
+// changes. The siblings carry the mtime of their source, a sibling whose mtime
+// equals the source's is up to date and skipped. -force ignores both.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/newacorn/goutils/compress"
+	ghttp "github.com/newacorn/goutils/http"
+	"github.com/newacorn/goutils/unsafefn"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type format struct {
+	ext   string
+	order compress.Order
+	level int
+}
+
+// highest quality of every codec.
+var formats = []format{
+	{".gz", compress.Gzip, compress.GzipBestCompression},
+	{".br", compress.Br, int(compress.BrotliBestCompression)},
+	{".zst", compress.Zstd, int(zstd.SpeedBestCompression)},
+}
+
+type stats struct {
+	written, skipped, notSmaller, failed atomic.Int64
+}
+
+func main() {
+	jobs := flag.Int("j", runtime.NumCPU(), "files compressed in parallel")
+	formatList := flag.String("formats", "gz,br,zst", "comma separated output formats")
+	force := flag.Bool("force", false, "rewrite siblings that are up to date")
+	verbose := flag.Bool("v", false, "log every file written")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintf(flag.CommandLine.Output(), "usage: precompress [flags] dir...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	fms, err := selectFormats(*formatList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := &precompressor{formats: fms, force: *force, verbose: *verbose}
+	if err = p.run(flag.Args(), *jobs); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("written %d, up to date %d, not smaller %d, failed %d",
+		p.stats.written.Load(), p.stats.skipped.Load(), p.stats.notSmaller.Load(), p.stats.failed.Load())
+	if p.stats.failed.Load() > 0 {
+		os.Exit(1)
+	}
+}
+
+func selectFormats(list string) (fms []format, err error) {
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, f := range formats {
+			if f.ext[1:] == name {
+				fms = append(fms, f)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown format %q", name)
+		}
+	}
+	return
+}
+
+type precompressor struct {
+	formats []format
+	force   bool
+	verbose bool
+	stats   stats
+}
+
+func (p *precompressor) run(dirs []string, jobs int) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	paths := make(chan job, jobs)
+	wg := sync.WaitGroup{}
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range paths {
+				p.file(j.path, j.manifest)
+			}
+		}()
+	}
+	var err error
+	var manifests []*skipManifest
+	for _, dir := range dirs {
+		var m *skipManifest
+		if fi, statErr := os.Stat(dir); statErr == nil && fi.IsDir() {
+			m = loadManifest(dir)
+			manifests = append(manifests, m)
+		}
+		err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() && p.compressible(path) {
+				paths <- job{path: path, manifest: m}
+			}
+			return nil
+		})
+		if err != nil {
+			break
+		}
+	}
+	close(paths)
+	wg.Wait()
+	for _, m := range manifests {
+		if saveErr := m.save(); err == nil {
+			err = saveErr
+		}
+	}
+	return err
+}
+
+// job a file to compress and the manifest of the directory it was found in,
+// nil when the file was given directly.
+type job struct {
+	path     string
+	manifest *skipManifest
+}
+
+func (p *precompressor) compressible(path string) bool {
+	ext := filepath.Ext(path)
+	for _, f := range formats {
+		if ext == f.ext {
+			return false
+		}
+	}
+	return compress.CheckMimeOk(unsafefn.S2B(ghttp.TypeByExtension(ext, "")))
+}
+
+func (p *precompressor) file(path string, m *skipManifest) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		p.stats.failed.Add(1)
+		log.Println(err)
+		return
+	}
+	for _, f := range p.formats {
+		out := path + f.ext
+		if !p.force {
+			if ofi, err := os.Stat(out); err == nil && ofi.ModTime().Equal(fi.ModTime()) {
+				p.stats.skipped.Add(1)
+				continue
+			}
+			if m != nil && m.notSmaller(out, fi) {
+				p.stats.skipped.Add(1)
+				continue
+			}
+		}
+		kept, err := compressFile(path, out, fi, f)
+		if err == nil && m != nil {
+			m.record(out, fi, !kept)
+		}
+		switch {
+		case err != nil:
+			p.stats.failed.Add(1)
+			log.Printf("%s: %v", out, err)
+		case !kept:
+			p.stats.notSmaller.Add(1)
+		default:
+			p.stats.written.Add(1)
+			if p.verbose {
+				log.Println(out)
+			}
+		}
+	}
+}
+
+// compressFile writes src compressed to out through a temporary file. kept is
+// false when the result is not smaller than src, then out is removed.
+func compressFile(src, out string, fi os.FileInfo, f format) (kept bool, err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer func() { _ = in.Close() }()
+	tmp, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if !kept {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	bw := bpool.GetBw(bpool.Block8k * 4)
+	bw.Reset(tmp)
+	err = compressTo(bw, in, f)
+	if err == nil {
+		err = bw.Flush()
+	}
+	bpool.PutBw(bw)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	tfi, err := os.Stat(tmp.Name())
+	if err != nil {
+		return
+	}
+	if tfi.Size() >= fi.Size() {
+		if err = os.Remove(out); os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if err = os.Chmod(tmp.Name(), fi.Mode().Perm()); err != nil {
+		return
+	}
+	if err = os.Chtimes(tmp.Name(), fi.ModTime(), fi.ModTime()); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), out); err != nil {
+		return
+	}
+	return true, nil
+}
+
+func compressTo(dst *bufio.Writer, src *os.File, f format) (err error) {
+	p := compress.Pool(f.level, f.order)
+	w := p.Get()
+	w.Reset(dst)
+	_, err = bpool.Copy(w, src)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	// a writer that did not complete its stream is not pooled, the cgo
+	// brotli one would carry it over to the next file.
+	if err == nil {
+		w.Reset(nil)
+		p.Put(w)
+	}
+	return
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrecompress(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "assets")
+	assert.NoErr(t, os.Mkdir(sub, 0o755))
+	js := filepath.Join(sub, "app.js")
+	assert.NoErr(t, os.WriteFile(js, []byte(strings.Repeat("console.log('hello');\n", 500)), 0o644))
+	tiny := filepath.Join(dir, "tiny.css")
+	assert.NoErr(t, os.WriteFile(tiny, []byte("a{}"), 0o644))
+	png := filepath.Join(dir, "logo.png")
+	assert.NoErr(t, os.WriteFile(png, []byte(strings.Repeat("x", 4096)), 0o644))
+	//
+	p := &precompressor{formats: formats}
+	assert.NoErr(t, p.run([]string{dir}, 2))
+	assert.Eq(t, int64(3), p.stats.written.Load())
+	assert.Eq(t, int64(3), p.stats.notSmaller.Load())
+	fi, err := os.Stat(js)
+	assert.NoErr(t, err)
+	for _, ext := range []string{".gz", ".br", ".zst"} {
+		ofi, err := os.Stat(js + ext)
+		assert.NoErr(t, err)
+		assert.True(t, ofi.ModTime().Equal(fi.ModTime()))
+		_, err = os.Stat(tiny + ext)
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(png + ext)
+		assert.True(t, os.IsNotExist(err))
+	}
+	m := loadManifest(dir)
+	assert.Len(t, m.entries, 3)
+	assert.True(t, m.notSmaller(tiny+".br", mustStat(t, tiny)))
+	// second run has nothing to do, tiny.css is not tried again.
+	p = &precompressor{formats: formats}
+	assert.NoErr(t, p.run([]string{dir}, 2))
+	assert.Eq(t, int64(0), p.stats.written.Load())
+	assert.Eq(t, int64(0), p.stats.notSmaller.Load())
+	assert.Eq(t, int64(6), p.stats.skipped.Load())
+	// touched sources are compressed again.
+	assert.NoErr(t, os.Chtimes(js, time.Now(), time.Now().Add(time.Minute)))
+	assert.NoErr(t, os.Chtimes(tiny, time.Now(), time.Now().Add(time.Minute)))
+	p = &precompressor{formats: formats[:1]}
+	assert.NoErr(t, p.run([]string{dir}, 1))
+	assert.Eq(t, int64(1), p.stats.written.Load())
+	assert.Eq(t, int64(1), p.stats.notSmaller.Load())
+	// the entries of a removed source are dropped.
+	assert.NoErr(t, os.Remove(tiny))
+	p = &precompressor{formats: formats}
+	assert.NoErr(t, p.run([]string{dir}, 1))
+	_, err = os.Stat(filepath.Join(dir, manifestName))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func mustStat(t *testing.T, path string) os.FileInfo {
+	fi, err := os.Stat(path)
+	assert.NoErr(t, err)
+	return fi
+}
+
+func TestSelectFormats(t *testing.T) {
+	fms, err := selectFormats("br, zst")
+	assert.NoErr(t, err)
+	assert.Eq(t, 2, len(fms))
+	assert.Eq(t, ".br", fms[0].ext)
+	_, err = selectFormats("lz4")
+	assert.Err(t, err)
+}
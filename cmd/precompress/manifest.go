@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// manifestName file at the root of every directory argument listing the
+// outputs found not smaller than their source, it has no extension and is
+// never compressed itself.
+const manifestName = ".precompress-skip"
+
+// skipEntry source mtime and size when its output was found not smaller.
+type skipEntry struct {
+	ModTime int64 `json:"mtime"`
+	Size    int64 `json:"size"`
+}
+
+// skipManifest outputs not worth writing, keyed by their path relative to dir
+// with slashes. An output whose source still has the recorded mtime and size
+// is not compressed again.
+type skipManifest struct {
+	dir     string
+	mu      sync.Mutex
+	entries map[string]skipEntry
+	dirty   bool
+}
+
+// loadManifest reads the manifest of dir, a missing or unreadable one is empty.
+func loadManifest(dir string) *skipManifest {
+	m := &skipManifest{dir: dir, entries: map[string]skipEntry{}}
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err == nil && json.Unmarshal(data, &m.entries) != nil {
+		m.entries = map[string]skipEntry{}
+		m.dirty = true
+	}
+	return m
+}
+
+func (m *skipManifest) key(out string) string {
+	rel, err := filepath.Rel(m.dir, out)
+	if err != nil {
+		return filepath.ToSlash(out)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// notSmaller reports that out was found not smaller than the source as it is now.
+func (m *skipManifest) notSmaller(out string, fi os.FileInfo) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[m.key(out)]
+	return ok && e.ModTime == fi.ModTime().UnixNano() && e.Size == fi.Size()
+}
+
+// record sets whether out is not smaller than the source described by fi.
+func (m *skipManifest) record(out string, fi os.FileInfo, notSmaller bool) {
+	key := m.key(out)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if notSmaller {
+		m.entries[key] = skipEntry{ModTime: fi.ModTime().UnixNano(), Size: fi.Size()}
+		m.dirty = true
+	} else if _, ok := m.entries[key]; ok {
+		delete(m.entries, key)
+		m.dirty = true
+	}
+}
+
+// save writes the manifest back when it changed, entries whose source is gone
+// are dropped. An empty manifest is removed.
+func (m *skipManifest) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.entries {
+		src := filepath.Join(m.dir, filepath.FromSlash(key))
+		if _, err := os.Stat(strings.TrimSuffix(src, filepath.Ext(src))); os.IsNotExist(err) {
+			delete(m.entries, key)
+			m.dirty = true
+		}
+	}
+	if !m.dirty {
+		return nil
+	}
+	path := filepath.Join(m.dir, manifestName)
+	if len(m.entries) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(m.entries, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,190 @@
+package compress
+
+import "bytes"
+
+// Identity the "identity" content-coding, no compression is applied.
+const Identity Order = "identity"
+
+// DefaultPreferOrders server side preference used by Negotiate when prefer is nil.
+var DefaultPreferOrders = []Order{Br, Zstd, Gzip, Deflate}
+
+// qvalues are kept as thousandths, "q=0.5" is 500.
+const (
+	qMax     = 1000
+	qUnset   = -1
+	qInvalid = -2
+)
+
+// NegotiateOrder picks the content-coding for a response from the value of the
+// request's Accept-Encoding header.
+//
+// Codings in prefer are weighted by the client's qvalues, on equal weight the one
+// that comes first in prefer wins. A coding not listed in the header inherits the
+// weight of "*", and is unacceptable when "*" is absent too. Identity is returned
+// when no coding in prefer is acceptable or the client explicitly weights identity
+// higher.
+// ok is false only when identity is also excluded ("identity;q=0" or "*;q=0"),
+// the caller should respond with 406 Not Acceptable.
+//
+// An empty header means only identity is acceptable. No allocation happens.
+func NegotiateOrder(acceptEncoding []byte, prefer []Order) (order Order, ok bool) {
+	if len(acceptEncoding) == 0 {
+		return Identity, true
+	}
+	if prefer == nil {
+		prefer = DefaultPreferOrders
+	}
+	starQ := acceptQ(acceptEncoding, "*")
+	bestQ := 0
+	for _, o := range prefer {
+		if o == Identity {
+			continue
+		}
+		q := acceptQ(acceptEncoding, string(o))
+		if q == qUnset && o == Gzip {
+			q = acceptQ(acceptEncoding, "x-gzip")
+		}
+		if q == qUnset {
+			q = starQ
+		}
+		if q > bestQ {
+			bestQ = q
+			order = o
+		}
+	}
+	identityQ := acceptQ(acceptEncoding, string(Identity))
+	if identityQ == qUnset {
+		// identity is always acceptable unless excluded, but an implicit
+		// identity never outweighs a coding the client asked for.
+		identityQ = 1
+		if starQ == 0 {
+			identityQ = 0
+		}
+	}
+	if order != "" && bestQ >= identityQ {
+		return order, true
+	}
+	if identityQ > 0 {
+		return Identity, true
+	}
+	return "", false
+}
+
+// Negotiate is NegotiateOrder returning the Pooler of the selected coding at level
+// and the token to send in Content-Encoding. For identity p is nil and
+// contentEncoding is empty.
+func Negotiate(acceptEncoding []byte, prefer []Order, level int) (p Pooler, contentEncoding string, ok bool) {
+	order, ok := NegotiateOrder(acceptEncoding, prefer)
+	if !ok || order == Identity {
+		return
+	}
+	return Pool(level, order), string(order), true
+}
+
+// acceptQ returns the qvalue of coding in the Accept-Encoding value h, qUnset when
+// the coding is not listed. A listed coding with malformed parameters is ignored.
+func acceptQ(h []byte, coding string) (q int) {
+	q = qUnset
+	for len(h) > 0 {
+		var elem []byte
+		i := bytes.IndexByte(h, ',')
+		if i < 0 {
+			elem, h = h, nil
+		} else {
+			elem, h = h[:i], h[i+1:]
+		}
+		elem = trimOWS(elem)
+		name := elem
+		var params []byte
+		if j := bytes.IndexByte(elem, ';'); j >= 0 {
+			name, params = trimOWS(elem[:j]), elem[j+1:]
+		}
+		if !equalFoldASCII(name, coding) {
+			continue
+		}
+		eq := parseQParam(params)
+		if eq == qInvalid {
+			continue
+		}
+		// Duplicate entries keep the highest weight.
+		if eq > q {
+			q = eq
+		}
+	}
+	return
+}
+
+// parseQParam finds the "q" parameter in params and parses it.
+func parseQParam(params []byte) int {
+	for len(params) > 0 {
+		var p []byte
+		i := bytes.IndexByte(params, ';')
+		if i < 0 {
+			p, params = params, nil
+		} else {
+			p, params = params[:i], params[i+1:]
+		}
+		p = trimOWS(p)
+		if len(p) < 2 || (p[0] != 'q' && p[0] != 'Q') {
+			continue
+		}
+		v := trimOWS(p[1:])
+		if len(v) == 0 || v[0] != '=' {
+			continue
+		}
+		return parseQValue(trimOWS(v[1:]))
+	}
+	return qMax
+}
+
+// parseQValue parses qvalue = ( "0" [ "." 0*3DIGIT ] ) / ( "1" [ "." 0*3("0") ] ).
+func parseQValue(v []byte) (q int) {
+	if len(v) == 0 || len(v) > 5 || (v[0] != '0' && v[0] != '1') {
+		return qInvalid
+	}
+	q = int(v[0]-'0') * qMax
+	if len(v) == 1 {
+		return
+	}
+	if v[1] != '.' {
+		return qInvalid
+	}
+	mul := 100
+	for _, c := range v[2:] {
+		if c < '0' || c > '9' {
+			return qInvalid
+		}
+		q += int(c-'0') * mul
+		mul /= 10
+	}
+	if q > qMax {
+		return qInvalid
+	}
+	return
+}
+
+func trimOWS(b []byte) []byte {
+	for len(b) > 0 && (b[0] == ' ' || b[0] == '\t') {
+		b = b[1:]
+	}
+	for len(b) > 0 && (b[len(b)-1] == ' ' || b[len(b)-1] == '\t') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+func equalFoldASCII(b []byte, s string) bool {
+	if len(b) != len(s) {
+		return false
+	}
+	for i := range b {
+		c := b[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != s[i] {
+			return false
+		}
+	}
+	return true
+}
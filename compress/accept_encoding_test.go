@@ -0,0 +1,64 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"testing"
+)
+
+func TestNegotiateOrder(t *testing.T) {
+	cases := []struct {
+		header string
+		prefer []Order
+		order  Order
+		ok     bool
+	}{
+		{"", nil, Identity, true},
+		{"gzip", nil, Gzip, true},
+		{"gzip, deflate, br, zstd", nil, Br, true},
+		{"gzip, deflate, br, zstd", []Order{Zstd, Gzip}, Zstd, true},
+		{"GZIP , Deflate", nil, Gzip, true},
+		{"x-gzip", nil, Gzip, true},
+		{"gzip;q=0.5, br;q=0.8", nil, Br, true},
+		{"gzip;q=1.0, br;q=0.8", nil, Gzip, true},
+		{"gzip ; q = 0.5 , deflate;q=0.4", nil, Gzip, true},
+		{"br;q=0, gzip", nil, Gzip, true},
+		{"*", nil, Br, true},
+		{"*;q=0.5, gzip", nil, Gzip, true},
+		{"*, br;q=0", nil, Zstd, true},
+		{"compress, unknown", nil, Identity, true},
+		{"gzip;q=0.1, identity", nil, Identity, true},
+		{"gzip;q=0", nil, Identity, true},
+		{"identity;q=0", nil, "", false},
+		{"*;q=0", nil, "", false},
+		{"*;q=0, identity", nil, Identity, true},
+		{"gzip;q=2", nil, Identity, true},
+		{"gzip;q=0.1234", nil, Identity, true},
+		{"gzip;level=1;q=0.3", nil, Gzip, true},
+		{"gzip", []Order{}, Identity, true},
+	}
+	for _, c := range cases {
+		order, ok := NegotiateOrder([]byte(c.header), c.prefer)
+		assert.Eq(t, c.ok, ok, c.header)
+		assert.Eq(t, c.order, order, c.header)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	p, ce, ok := Negotiate([]byte("gzip, br;q=0.9"), nil, -1)
+	assert.True(t, ok)
+	assert.Eq(t, "gzip", ce)
+	assert.Eq(t, Pooler(DefaultGzipCompressPools.Pool(-1)), p)
+	//
+	p, ce, ok = Negotiate([]byte("identity"), nil, -1)
+	assert.True(t, ok)
+	assert.Eq(t, "", ce)
+	assert.Nil(t, p)
+}
+
+func TestNegotiateNoAlloc(t *testing.T) {
+	h := []byte("gzip;q=0.8, deflate;q=0.5, br;q=0.9, zstd, *;q=0.1, identity;q=0.2")
+	n := testing.AllocsPerRun(100, func() {
+		_, _, _ = Negotiate(h, nil, 3)
+	})
+	assert.Eq(t, float64(0), n)
+}
@@ -0,0 +1,164 @@
+package compress
+
+import (
+	"github.com/klauspost/compress/zstd"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultLowLoad CPU utilisation in percent under which the idle levels are used.
+	DefaultLowLoad = 30
+	// DefaultHighLoad CPU utilisation in percent above which the busy levels are used.
+	DefaultHighLoad = 75
+	// DefaultSmallPayload payloads below are compressed one step harder.
+	DefaultSmallPayload = 16 << 10
+	// DefaultLargePayload payloads from this size are compressed one step lighter.
+	DefaultLargePayload = 1 << 20
+	// DefaultLoadInterval minimum time between two CPU samples.
+	DefaultLoadInterval = time.Second
+)
+
+// LoadLevels levels of one Order from an idle to a busy machine.
+type LoadLevels struct {
+	Idle   int
+	Normal int
+	Busy   int
+}
+
+func (l LoadLevels) step(i int) int {
+	switch {
+	case i <= 0:
+		return l.Idle
+	case i == 1:
+		return l.Normal
+	}
+	return l.Busy
+}
+
+// DefaultLoadLevels used for the Orders missing from AdaptiveOptions.Levels.
+var DefaultLoadLevels = map[Order]LoadLevels{
+	Gzip:    {Idle: 8, Normal: GzipDefaultCompression, Busy: GzipBestSpeed},
+	Deflate: {Idle: 8, Normal: DeflateDefaultCompression, Busy: DeflateBestSpeed},
+	Zstd:    {Idle: int(zstd.SpeedBetterCompression), Normal: int(zstd.SpeedDefault), Busy: int(zstd.SpeedFastest)},
+	Br:      {Idle: int(BrotliHighCompression), Normal: int(BrotliDefaultCompression), Busy: 1},
+}
+
+// AdaptiveOptions configures NewAdaptiveLevel, zero fields take the defaults.
+type AdaptiveOptions struct {
+	// LowLoad and HighLoad CPU utilisation thresholds in percent.
+	LowLoad  float64
+	HighLoad float64
+	// SmallPayload and LargePayload size thresholds in bytes.
+	SmallPayload int64
+	LargePayload int64
+	// Interval minimum time between two CPU samples.
+	Interval time.Duration
+	// Levels by Order, DefaultLoadLevels fills the missing ones.
+	Levels map[Order]LoadLevels
+	// Load CPU utilisation in percent since the previous call, nil samples
+	// the machine with gopsutil.
+	Load func() (float64, error)
+}
+
+// AdaptiveLevel picks compression levels from the payload size and the CPU
+// utilisation: lighter levels when the machine is busy, harder ones when it is
+// idle. Small payloads cost little whatever the level and go one step harder,
+// large ones one step lighter. It is safe for concurrent use.
+type AdaptiveLevel struct {
+	opts AdaptiveOptions
+	// load float64 bits of the last sample.
+	load atomic.Uint64
+	// next unix nano time of the next sample.
+	next atomic.Int64
+	mu   sync.Mutex
+	last cpu.TimesStat
+}
+
+// NewAdaptiveLevel see AdaptiveOptions.
+func NewAdaptiveLevel(opts AdaptiveOptions) *AdaptiveLevel {
+	if opts.LowLoad == 0 {
+		opts.LowLoad = DefaultLowLoad
+	}
+	if opts.HighLoad == 0 {
+		opts.HighLoad = DefaultHighLoad
+	}
+	if opts.SmallPayload == 0 {
+		opts.SmallPayload = DefaultSmallPayload
+	}
+	if opts.LargePayload == 0 {
+		opts.LargePayload = DefaultLargePayload
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultLoadInterval
+	}
+	levels := make(map[Order]LoadLevels, len(DefaultLoadLevels)+len(opts.Levels))
+	for o, l := range DefaultLoadLevels {
+		levels[o] = l
+	}
+	for o, l := range opts.Levels {
+		levels[o] = l
+	}
+	opts.Levels = levels
+	a := &AdaptiveLevel{opts: opts}
+	if a.opts.Load == nil {
+		a.opts.Load = a.cpuLoad
+	}
+	// the first gopsutil sample is the average since boot.
+	a.Load()
+	return a
+}
+
+// Level for a payload of size bytes compressed with order, size is negative
+// when unknown. Orders without LoadLevels get -1, the pool default.
+func (a *AdaptiveLevel) Level(order Order, size int64) int {
+	levels, ok := a.opts.Levels[order]
+	if !ok {
+		return -1
+	}
+	load := a.Load()
+	step := 1
+	if load < a.opts.LowLoad {
+		step = 0
+	} else if load >= a.opts.HighLoad {
+		step = 2
+	}
+	if size >= 0 && size < a.opts.SmallPayload {
+		step--
+	} else if size >= a.opts.LargePayload {
+		step++
+	}
+	return levels.step(step)
+}
+
+// Load the CPU utilisation in percent, sampled at most once per Interval.
+func (a *AdaptiveLevel) Load() float64 {
+	now := time.Now().UnixNano()
+	next := a.next.Load()
+	if now >= next && a.next.CompareAndSwap(next, now+int64(a.opts.Interval)) {
+		if load, err := a.opts.Load(); err == nil {
+			a.load.Store(math.Float64bits(load))
+		}
+	}
+	return math.Float64frombits(a.load.Load())
+}
+
+func (a *AdaptiveLevel) cpuLoad() (float64, error) {
+	times, err := cpu.Times(false)
+	if err != nil || len(times) == 0 {
+		return 0, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t := times[0]
+	total := t.Total() - a.last.Total()
+	idle := t.Idle + t.Iowait - a.last.Idle - a.last.Iowait
+	a.last = t
+	if total <= 0 {
+		return 0, nil
+	}
+	return min(max((total-idle)/total*100, 0), 100), nil
+}
@@ -0,0 +1,68 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLevel(t *testing.T) {
+	load := 50.0
+	a := NewAdaptiveLevel(AdaptiveOptions{
+		Interval: time.Nanosecond,
+		Levels:   map[Order]LoadLevels{Gzip: {Idle: 9, Normal: 5, Busy: 1}},
+		Load:     func() (float64, error) { return load, nil },
+	})
+	time.Sleep(time.Millisecond)
+	assert.Eq(t, 50.0, a.Load())
+	assert.Eq(t, 5, a.Level(Gzip, -1))
+	assert.Eq(t, 9, a.Level(Gzip, 100))
+	assert.Eq(t, 1, a.Level(Gzip, 10<<20))
+	assert.Eq(t, int(zstd.SpeedDefault), a.Level(Zstd, 100<<10))
+	assert.Eq(t, -1, a.Level(Dump, 100))
+	//
+	load = 90
+	time.Sleep(time.Millisecond)
+	assert.Eq(t, 1, a.Level(Gzip, -1))
+	assert.Eq(t, 5, a.Level(Gzip, 100))
+	assert.Eq(t, int(BrotliDefaultCompression), a.Level(Br, 100))
+	load = 5
+	time.Sleep(time.Millisecond)
+	assert.Eq(t, 9, a.Level(Gzip, -1))
+	assert.Eq(t, 9, a.Level(Gzip, 100))
+	assert.Eq(t, 5, a.Level(Gzip, 10<<20))
+}
+
+func TestAdaptiveLevelCPU(t *testing.T) {
+	a := NewAdaptiveLevel(AdaptiveOptions{})
+	load := a.Load()
+	assert.True(t, load >= 0 && load <= 100)
+}
+
+func TestHandlerAdaptive(t *testing.T) {
+	body := strings.Repeat("<p>hello world</p>", 200)
+	a := NewAdaptiveLevel(AdaptiveOptions{
+		Levels: map[Order]LoadLevels{Gzip: {Idle: 9, Normal: 9, Busy: 9}},
+		Load:   func() (float64, error) { return 50, nil },
+	})
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = io.WriteString(w, body)
+	}), HandlerOptions{Adaptive: a})
+	before := DefaultGzipCompressPools.Pool(9).Stats().Gets
+	rec := serveCompressed(h, "gzip")
+	assert.Eq(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Eq(t, before+1, DefaultGzipCompressPools.Pool(9).Stats().Gets)
+	gr, err := gzip.NewReader(rec.Body)
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(gr)
+	assert.NoErr(t, err)
+	assert.Eq(t, body, string(rs))
+}
@@ -0,0 +1,171 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io"
+)
+
+// autoPeekSize bytes at the head of the stream used by the brotli heuristic.
+const autoPeekSize = 4096
+
+// autoBrotliProbeOut decoded bytes after which the head is taken as brotli,
+// a few compressed bytes can expand to gigabytes.
+const autoBrotliProbeOut = 16 * autoPeekSize
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b, 0x08}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// DetectOrder reports the coding of a stream beginning with head from its magic
+// bytes: gzip, zlib (Deflate), zstd frame or zstd skippable frame. Identity is
+// returned when nothing matched, brotli has no magic number and is never detected.
+func DetectOrder(head []byte) Order {
+	if bytes.HasPrefix(head, gzipMagic) {
+		return Gzip
+	}
+	if bytes.HasPrefix(head, zstdMagic) {
+		return Zstd
+	}
+	// skippable frame, magic 0x184D2A5?, little endian.
+	if len(head) >= 4 && head[0]&0xf0 == 0x50 && head[1] == 0x2a && head[2] == 0x4d && head[3] == 0x18 {
+		return Zstd
+	}
+	// zlib header: CM 8, CINFO <= 7, no preset dictionary (FDICT) and the check
+	// bits (RFC 1950 section 2.2). A dictionary can not be supplied here, text
+	// such as "hb" matching the rest is passed through.
+	if len(head) >= 2 && head[0]&0x0f == 8 && head[0]>>4 <= 7 && head[1]&0x20 == 0 &&
+		(uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return Deflate
+	}
+	return Identity
+}
+
+// NewAutoReader decodes r with the pooled decoder of the coding found at its head
+// by DetectOrder, data that matches nothing is passed through unchanged, as is
+// data whose decoder fails on the header following the magic bytes. order is
+// the coding used. Close returns the decoder to its pool.
+func NewAutoReader(r io.Reader) (rc io.ReadCloser, order Order, err error) {
+	return newAutoReader(r, false)
+}
+
+// NewAutoReaderBrotli is NewAutoReader that, when no magic bytes matched, takes
+// the stream as brotli if its head decodes without error. It's a heuristic, data
+// that is not compressed can pass it, only use it for sources known to be either
+// brotli or one of the detectable codings.
+func NewAutoReaderBrotli(r io.Reader) (rc io.ReadCloser, order Order, err error) {
+	return newAutoReader(r, true)
+}
+
+func newAutoReader(r io.Reader, brotliFallback bool) (rc io.ReadCloser, order Order, err error) {
+	br := bpool.GetBr(autoPeekSize)
+	br.Reset(r)
+	head, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		bpool.PutBr(br)
+		return nil, "", err
+	}
+	order = DetectOrder(head)
+	if order == Identity && brotliFallback && looksLikeBrotli(br) {
+		order = Br
+	}
+	ar := &autoReader{br: br}
+	if order != Identity {
+		// the decoder reads its header from the peeked bytes, br is untouched
+		// when it fails there.
+		head, err = br.Peek(autoPeekSize)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			err = nil
+		}
+		ar.replay = replayReader{br: br, head: head, err: err}
+		ar.ReadCloser, err = NewReader(order, &ar.replay)
+		if err != nil && !ar.replay.passed {
+			order, err = Identity, nil
+		}
+		if err != nil {
+			bpool.PutBr(br)
+			return nil, "", err
+		}
+	}
+	if order == Identity {
+		ar.ReadCloser, _ = NewReader(Identity, br)
+	}
+	return ar, order, nil
+}
+
+// replayReader reads head, the peeked bytes of br, and then br. err ended the
+// peek, the stream has nothing past head.
+type replayReader struct {
+	br     *bufio.Reader
+	head   []byte
+	err    error
+	off    int
+	passed bool
+}
+
+func (r *replayReader) Read(p []byte) (n int, err error) {
+	if !r.passed {
+		if r.off < len(r.head) {
+			n = copy(p, r.head[r.off:])
+			r.off += n
+			return
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		if _, err = r.br.Discard(len(r.head)); err != nil {
+			return
+		}
+		r.passed = true
+	}
+	return r.br.Read(p)
+}
+
+// looksLikeBrotli trial decodes the buffered head of br, up to
+// autoBrotliProbeOut decoded bytes.
+func looksLikeBrotli(br *bufio.Reader) bool {
+	head, err := br.Peek(autoPeekSize)
+	if len(head) == 0 || (err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull)) {
+		return false
+	}
+	d := DefaultBrotliReaderPool.Get()
+	_ = d.Reset(bytes.NewReader(head))
+	scratch := bpool.Get(autoPeekSize)
+	buf := scratch.B[:autoPeekSize]
+	for out := 0; out < autoBrotliProbeOut; {
+		var n int
+		n, err = d.Read(buf)
+		out += n
+		if err != nil {
+			break
+		}
+	}
+	bpool.Put(scratch)
+	if err == nil {
+		// stopped in the middle of the head, Reset would keep the input
+		// left, d is not pooled.
+		return true
+	}
+	_ = d.Close()
+	DefaultBrotliReaderPool.Put(d)
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+type autoReader struct {
+	io.ReadCloser
+	br     *bufio.Reader
+	replay replayReader
+}
+
+func (a *autoReader) Close() (err error) {
+	if a.br == nil {
+		return errReaderClosed
+	}
+	err = a.ReadCloser.Close()
+	bpool.PutBr(a.br)
+	a.br = nil
+	return
+}
@@ -0,0 +1,104 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/goutils/bytes"
+	"github.com/xyproto/randomstring"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDetectOrder(t *testing.T) {
+	assert.Eq(t, Gzip, DetectOrder([]byte{0x1f, 0x8b, 0x08, 0x00}))
+	assert.Eq(t, Order(Zstd), DetectOrder([]byte{0x28, 0xb5, 0x2f, 0xfd}))
+	assert.Eq(t, Order(Zstd), DetectOrder([]byte{0x5a, 0x2a, 0x4d, 0x18}))
+	for _, h := range [][]byte{{0x78, 0x01}, {0x78, 0x5e}, {0x78, 0x9c}, {0x78, 0xda}} {
+		assert.Eq(t, Order(Deflate), DetectOrder(h))
+	}
+	assert.Eq(t, Identity, DetectOrder([]byte("{\"a\":1}")))
+	// check bits right, FDICT set.
+	assert.Eq(t, Identity, DetectOrder([]byte("80 percent of users")))
+	assert.Eq(t, Identity, DetectOrder([]byte("hb")))
+	// CINFO 8.
+	assert.Eq(t, Identity, DetectOrder([]byte{0x88, 0x1c}))
+	assert.Eq(t, Identity, DetectOrder(nil))
+}
+
+func TestNewAutoReader(t *testing.T) {
+	dataBytes := []byte(randomstring.HumanFriendlyString(20000))
+	for _, order := range []Order{Gzip, Deflate, Zstd} {
+		t.Run(string(order), func(t *testing.T) {
+			compressed := compressForTest(t, order, -1, dataBytes)
+			r, detected, err := NewAutoReader(bytes.NewBuffer(compressed))
+			assert.NoErr(t, err)
+			assert.Eq(t, order, detected)
+			rs, err := io.ReadAll(r)
+			assert.NoErr(t, err)
+			assert.Eq(t, dataBytes, rs)
+			assert.NoErr(t, r.Close())
+		})
+	}
+	// zstd stream led by a skippable frame.
+	compressed := compressForTest(t, Zstd, -1, dataBytes)
+	skippable := append([]byte{0x50, 0x2a, 0x4d, 0x18, 3, 0, 0, 0, 'a', 'b', 'c'}, compressed...)
+	r, detected, err := NewAutoReader(bytes.NewBuffer(skippable))
+	assert.NoErr(t, err)
+	assert.Eq(t, Order(Zstd), detected)
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, dataBytes, rs)
+	assert.NoErr(t, r.Close())
+	//
+	r, detected, err = NewAutoReader(strings.NewReader("plain text"))
+	assert.NoErr(t, err)
+	assert.Eq(t, Identity, detected)
+	rs, err = io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, "plain text", string(rs))
+	assert.NoErr(t, r.Close())
+	// gzip magic bytes with a cut header are passed through.
+	for _, plain := range []string{"80 percent of users", "hb", "\x1f\x8b\x08\x00"} {
+		r, detected, err = NewAutoReader(strings.NewReader(plain))
+		assert.NoErr(t, err)
+		assert.Eq(t, Identity, detected)
+		rs, err = io.ReadAll(r)
+		assert.NoErr(t, err)
+		assert.Eq(t, plain, string(rs))
+		assert.NoErr(t, r.Close())
+	}
+}
+
+func TestNewAutoReaderBrotli(t *testing.T) {
+	dataBytes := []byte(randomstring.HumanFriendlyString(20000))
+	compressed := compressForTest(t, Br, 4, dataBytes)
+	// without the fallback brotli passes through.
+	r, detected, err := NewAutoReader(bytes.NewBuffer(compressed))
+	assert.NoErr(t, err)
+	assert.Eq(t, Identity, detected)
+	assert.NoErr(t, r.Close())
+	//
+	r, detected, err = NewAutoReaderBrotli(bytes.NewBuffer(compressed))
+	assert.NoErr(t, err)
+	assert.Eq(t, Order(Br), detected)
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, dataBytes, rs)
+	assert.NoErr(t, r.Close())
+	//
+	r, detected, err = NewAutoReaderBrotli(strings.NewReader("plain text, not brotli at all"))
+	assert.NoErr(t, err)
+	assert.Eq(t, Identity, detected)
+	assert.NoErr(t, r.Close())
+	// a head expanding far beyond the probe is taken as brotli without
+	// being decoded in full.
+	zeros := make([]byte, 32<<20)
+	compressed = compressForTest(t, Br, 4, zeros)
+	r, detected, err = NewAutoReaderBrotli(bytes.NewBuffer(compressed))
+	assert.NoErr(t, err)
+	assert.Eq(t, Order(Br), detected)
+	n, err := io.Copy(io.Discard, r)
+	assert.NoErr(t, err)
+	assert.Eq(t, int64(len(zeros)), n)
+	assert.NoErr(t, r.Close())
+}
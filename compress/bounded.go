@@ -0,0 +1,229 @@
+package compress
+
+import (
+	"github.com/klauspost/compress/zstd"
+	"sync"
+)
+
+// DefaultBoundedMaxIdle idle encoders kept per level when MaxIdle is unset.
+const DefaultBoundedMaxIdle = 16
+
+// BoundedOptions configures NewBoundedPools.
+type BoundedOptions struct {
+	// MaxIdle idle encoders kept per level, 0 means DefaultBoundedMaxIdle.
+	MaxIdle int
+	// Budget memory the idle encoders may hold, shared by any number of
+	// containers. nil means no limit besides MaxIdle.
+	Budget *MemoryBudget
+	// Cost estimated memory of an encoder of level, nil means EncoderCost.
+	Cost func(level int) int64
+}
+
+// MemoryBudget upper bound of the memory held by idle encoders. The zero value
+// has no limit.
+type MemoryBudget struct {
+	// Max bytes, 0 means no limit.
+	Max  int64
+	mu   sync.Mutex
+	used int64
+}
+
+// NewMemoryBudget max bytes shared by the pools using it.
+func NewMemoryBudget(max int64) *MemoryBudget {
+	return &MemoryBudget{Max: max}
+}
+
+// Used bytes held by idle encoders.
+func (b *MemoryBudget) Used() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+func (b *MemoryBudget) reserve(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Max > 0 && b.used+n > b.Max {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+func (b *MemoryBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+}
+
+// BoundedPool a Pooler keeping at most MaxIdle encoders, within the budget.
+// Unlike CompressPool nothing is dropped at GC, and encoders that do not fit
+// are destroyed right away instead of waiting for a finalizer.
+type BoundedPool[T comWriter] struct {
+	newFn      func() any
+	needBuffer bool
+	maxIdle    int
+	cost       int64
+	budget     *MemoryBudget
+	mu         sync.Mutex
+	idle       []Writer
+	closed     bool
+	counters   poolCounters
+}
+
+func (b *BoundedPool[T]) NeedBuffer() bool {
+	return b.needBuffer
+}
+
+func (b *BoundedPool[T]) Get() Writer {
+	b.counters.gets.Add(1)
+	b.mu.Lock()
+	if n := len(b.idle); n > 0 {
+		w := b.idle[n-1]
+		b.idle[n-1] = nil
+		b.idle = b.idle[:n-1]
+		b.mu.Unlock()
+		if b.budget != nil {
+			b.budget.release(b.cost)
+		}
+		return w
+	}
+	b.mu.Unlock()
+	b.counters.news.Add(1)
+	return b.newFn().(Writer)
+}
+
+// Put keeps w for later use, or destroys it when the pool is full, the budget
+// is exhausted or the pool is closed.
+func (b *BoundedPool[T]) Put(w Writer) {
+	b.counters.puts.Add(1)
+	b.mu.Lock()
+	if b.closed || len(b.idle) >= b.maxIdle || (b.budget != nil && !b.budget.reserve(b.cost)) {
+		b.mu.Unlock()
+		destroyWriter(w)
+		return
+	}
+	b.idle = append(b.idle, w)
+	b.mu.Unlock()
+}
+
+// Idle number of pooled encoders.
+func (b *BoundedPool[T]) Idle() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.idle)
+}
+
+// AddBytes see CompressPool.AddBytes.
+func (b *BoundedPool[T]) AddBytes(in, out int64) {
+	b.counters.bytesIn.Add(in)
+	b.counters.bytesOut.Add(out)
+}
+
+// Stats see CompressPool.Stats.
+func (b *BoundedPool[T]) Stats() LevelStats {
+	return LevelStats{
+		Gets:     b.counters.gets.Load(),
+		Puts:     b.counters.puts.Load(),
+		News:     b.counters.news.Load(),
+		BytesIn:  b.counters.bytesIn.Load(),
+		BytesOut: b.counters.bytesOut.Load(),
+	}
+}
+
+func (b *BoundedPool[T]) close() {
+	b.mu.Lock()
+	idle := b.idle
+	b.idle = nil
+	b.closed = true
+	b.mu.Unlock()
+	for _, w := range idle {
+		destroyWriter(w)
+	}
+	if b.budget != nil {
+		b.budget.release(int64(len(idle)) * b.cost)
+	}
+}
+
+// BoundedPoolContainer levels of BoundedPool, used like PoolContainer.
+type BoundedPoolContainer[T comWriter] struct {
+	pools        [levelCount]*BoundedPool[T]
+	defaultLevel int
+	offset       int
+}
+
+// NewBoundedPools bounded pools creating the same encoders as base.
+//
+//	pools := compress.NewBoundedPools(compress.DefaultCBrotliCompressPools, compress.BoundedOptions{
+//		MaxIdle: 8,
+//		Budget:  compress.NewMemoryBudget(256 << 20),
+//	})
+//	defer pools.Close()
+func NewBoundedPools[T comWriter](base *PoolContainer[T], opts BoundedOptions) *BoundedPoolContainer[T] {
+	maxIdle := opts.MaxIdle
+	if maxIdle <= 0 {
+		maxIdle = DefaultBoundedMaxIdle
+	}
+	cost := opts.Cost
+	if cost == nil {
+		cost = func(level int) int64 {
+			var t T
+			return EncoderCost(Writer(t), level)
+		}
+	}
+	c := &BoundedPoolContainer[T]{defaultLevel: base.defaultLevel, offset: base.offset}
+	// fresh pools so that base's counters are left alone.
+	for i, p := range base.poolsInit() {
+		c.pools[i] = &BoundedPool[T]{
+			newFn:      p.New,
+			needBuffer: p.needBuffer,
+			maxIdle:    maxIdle,
+			cost:       cost(i - base.offset),
+			budget:     opts.Budget,
+		}
+	}
+	return c
+}
+
+func (c *BoundedPoolContainer[T]) Pool(level int) *BoundedPool[T] {
+	level = c.offset + level
+	if level < 0 || level >= levelCount {
+		level = c.defaultLevel + c.offset
+	}
+	return c.pools[level]
+}
+
+// Stats see PoolContainer.Stats.
+func (c *BoundedPoolContainer[T]) Stats() []LevelStats {
+	stats := make([]LevelStats, 0, levelCount)
+	for i, p := range c.pools {
+		s := p.Stats()
+		s.Level = i - c.offset
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// Close destroys the idle encoders, those still in use are destroyed when put
+// back. The pools keep creating encoders for Get.
+func (c *BoundedPoolContainer[T]) Close() {
+	for _, p := range c.pools {
+		p.close()
+	}
+}
+
+// EncoderCost rough memory of an encoder of the type of w at level, as created
+// by the default pools.
+func EncoderCost(w Writer, level int) int64 {
+	if cost, ok := cgoEncoderCost(w, level); ok {
+		return cost
+	}
+	if _, ok := w.(*zstd.Encoder); ok {
+		if level >= int(zstd.SpeedBetterCompression) {
+			return 16 << 20
+		}
+		return 8 << 20
+	}
+	// flate based writers, the s2 writers and the pure go brotli writer.
+	return 1 << 20
+}
@@ -0,0 +1,44 @@
+//go:build cgo
+
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/goutils/bytes"
+	"io"
+	"testing"
+)
+
+func TestBoundedPools(t *testing.T) {
+	pools := NewBoundedPools(DefaultCBrotliCompressPools, BoundedOptions{MaxIdle: 1})
+	p := pools.Pool(5)
+	w1, w2 := p.Get(), p.Get()
+	for _, w := range []Writer{w1, w2} {
+		buf := bytes.Buffer{}
+		w.Reset(&buf)
+		_, err := w.Write([]byte("hello hello hello"))
+		assert.NoErr(t, err)
+		assert.NoErr(t, w.Close())
+		r, err := NewReader(Br, &buf)
+		assert.NoErr(t, err)
+		rs, err := io.ReadAll(r)
+		assert.NoErr(t, err)
+		assert.Eq(t, "hello hello hello", string(rs))
+		assert.NoErr(t, r.Close())
+	}
+	p.Put(w1)
+	p.Put(w2)
+	assert.Eq(t, 1, p.Idle())
+	// w2 did not fit and was destroyed.
+	w2.Reset(io.Discard)
+	_, err := w2.Write([]byte("x"))
+	assert.Err(t, err)
+	assert.Eq(t, w1, p.Get())
+	p.Put(w1)
+	//
+	pools.Close()
+	assert.Eq(t, 0, p.Idle())
+	s := pools.Stats()[5]
+	assert.Eq(t, int64(3), s.Gets)
+	assert.Eq(t, int64(2), s.News)
+}
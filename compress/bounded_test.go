@@ -0,0 +1,36 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"testing"
+)
+
+func TestBoundedPoolsBudget(t *testing.T) {
+	budget := NewMemoryBudget(15)
+	pools := NewBoundedPools(DefaultGzipCompressPools, BoundedOptions{
+		Budget: budget,
+		Cost:   func(int) int64 { return 10 },
+	})
+	other := NewBoundedPools(DefaultZstdCompressPools, BoundedOptions{
+		Budget: budget,
+		Cost:   func(int) int64 { return 10 },
+	})
+	a, b := pools.Pool(1), other.Pool(1)
+	wa, wb := a.Get(), b.Get()
+	a.Put(wa)
+	b.Put(wb)
+	assert.Eq(t, 1, a.Idle())
+	assert.Eq(t, 0, b.Idle())
+	assert.Eq(t, int64(10), budget.Used())
+	// taking it out frees its share.
+	a.Put(a.Get())
+	assert.Eq(t, int64(10), budget.Used())
+	pools.Close()
+	assert.Eq(t, int64(0), budget.Used())
+	b.Put(b.Get())
+	assert.Eq(t, 1, b.Idle())
+	other.Close()
+	assert.Eq(t, int64(0), budget.Used())
+	//
+	var _ Pooler = pools.Pool(-1)
+}
@@ -0,0 +1,163 @@
+package compress
+
+import (
+	"errors"
+	"github.com/newacorn/brotli"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrNoCgo the cgo brotli implementation was asked for in a build without cgo.
+	ErrNoCgo = errors.New("compress: cgo brotli is not available, built without cgo")
+	// ErrUnknownBrotliImpl SetBrotliImpl was given none of the BrotliImpl constants.
+	ErrUnknownBrotliImpl = errors.New("compress: unknown brotli implementation")
+)
+
+// BrotliImpl implementation behind Br, in Pool and NewReader.
+type BrotliImpl uint32
+
+const (
+	// BrotliAuto the cgo implementation when built with cgo, the pure go one
+	// otherwise.
+	BrotliAuto BrotliImpl = iota
+	// BrotliCgo DefaultCBrotliCompressPools and DefaultCBrotliReaderPool.
+	BrotliCgo
+	// BrotliPure DefaultBrotliCompressPools and DefaultBrotliReaderPool.
+	BrotliPure
+)
+
+var brotliImpl atomic.Uint32
+
+// SetBrotliImpl selects the brotli implementation, ErrNoCgo when impl is
+// BrotliCgo in a build without cgo. Writers and readers already handed out
+// go back to the pools they came from.
+func SetBrotliImpl(impl BrotliImpl) error {
+	if impl > BrotliPure {
+		return ErrUnknownBrotliImpl
+	}
+	if impl == BrotliCgo && !cgoBrotli {
+		return ErrNoCgo
+	}
+	brotliImpl.Store(uint32(impl))
+	return nil
+}
+
+// CurrentBrotliImpl BrotliCgo or BrotliPure, the implementation in use.
+func CurrentBrotliImpl() BrotliImpl {
+	impl := BrotliImpl(brotliImpl.Load())
+	if impl == BrotliAuto {
+		if cgoBrotli {
+			return BrotliCgo
+		}
+		return BrotliPure
+	}
+	return impl
+}
+
+func (i BrotliImpl) String() string {
+	switch i {
+	case BrotliAuto:
+		return "auto"
+	case BrotliCgo:
+		return "cgo"
+	case BrotliPure:
+		return "pure"
+	}
+	return "unknown"
+}
+
+func brotliPool(level int) Pooler {
+	if CurrentBrotliImpl() == BrotliCgo {
+		return cbrotliPool(level)
+	}
+	return DefaultBrotliCompressPools.Pool(level)
+}
+
+func newBrotliReader(src io.Reader) (io.Reader, error) {
+	if CurrentBrotliImpl() == BrotliCgo {
+		return cbrotliReader(src)
+	}
+	g := goBrotliReaderPool.Get().(*goBrotliReader)
+	g.br = DefaultBrotliReaderPool.Get()
+	g.tail.src = src
+	if err := g.br.Reset(&g.tail); err != nil {
+		g.release()
+		return nil, err
+	}
+	return g, nil
+}
+
+// goBrotliReader the pure go decoder returns io.EOF when src ends in the middle
+// of a stream. At the end of src it's fed one more byte, a finished decoder
+// refuses it as excessive input, otherwise the stream was cut and
+// io.ErrUnexpectedEOF is returned.
+type goBrotliReader struct {
+	br   *brotli.Reader
+	tail brotliTail
+	end  error
+}
+
+var goBrotliReaderPool = sync.Pool{New: func() any {
+	return &goBrotliReader{}
+}}
+
+// brotliExcessiveInput message of the decoder's unexported error.
+const brotliExcessiveInput = "brotli: excessive input"
+
+func (g *goBrotliReader) Read(p []byte) (n int, err error) {
+	if g.end != nil {
+		return 0, g.end
+	}
+	n, err = g.br.Read(p)
+	if err != io.EOF {
+		return
+	}
+	g.tail.probe = true
+	var scratch [64]byte
+	_, err = g.br.Read(scratch[:])
+	if err != nil && err.Error() == brotliExcessiveInput {
+		g.end = io.EOF
+		// Reset keeps the refused byte as input, it's taken as the head of
+		// an empty stream so that the pooled decoder starts clean.
+		_ = g.br.Reset(eofReader{})
+		_, _ = g.br.Read(scratch[:])
+	} else {
+		g.end = io.ErrUnexpectedEOF
+	}
+	return n, g.end
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (g *goBrotliReader) release() (err error) {
+	err = g.br.Close()
+	DefaultBrotliReaderPool.Put(g.br)
+	*g = goBrotliReader{}
+	goBrotliReaderPool.Put(g)
+	return
+}
+
+// brotliTail reads src, then the probe byte once probe is set.
+type brotliTail struct {
+	src    io.Reader
+	probe  bool
+	probed bool
+}
+
+func (t *brotliTail) Read(p []byte) (int, error) {
+	if !t.probe {
+		return t.src.Read(p)
+	}
+	if t.probed || len(p) == 0 {
+		return 0, io.EOF
+	}
+	t.probed = true
+	p[0] = 0
+	return 1, nil
+}
@@ -0,0 +1,104 @@
+//go:build cgo
+
+package compress
+
+import (
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/newacorn/brotli/matchfinder"
+	"github.com/newacorn/cbrotli/go/cbrotli"
+	"io"
+	"runtime"
+	"sync"
+)
+
+const cgoBrotli = true
+
+type comWriter interface {
+	*gzip.Writer | *zlib.Writer | *matchfinder.Writer | *zstd.Encoder | *s2.Writer | *cbrotli.WWriter
+}
+
+var DefaultCBrotliCompressPools = &PoolContainer[*cbrotli.WWriter]{
+	defaultLevel: 3,
+	offset:       0,
+	poolsInit: func() [12]*CompressPool[*cbrotli.WWriter] {
+		var pools [12]*CompressPool[*cbrotli.WWriter]
+		for i := range pools {
+			level := i
+			pools[i] = &CompressPool[*cbrotli.WWriter]{Pool: sync.Pool{
+				New: func() any {
+					w := cbrotli.NewWWriter(nil, cbrotli.WriterV2Options{
+						Quality: level,
+					})
+					runtime.SetFinalizer(w, func(w *cbrotli.WWriter) {
+						w.Destroy()
+					})
+					return w
+				}}}
+		}
+		return pools
+	},
+}
+
+var DefaultCBrotliReaderPool CBrotliReaderPool
+
+func init() {
+	DefaultCBrotliCompressPools.init()
+}
+
+func cbrotliPool(level int) Pooler {
+	return DefaultCBrotliCompressPools.Pool(level)
+}
+
+func cbrotliReader(src io.Reader) (io.Reader, error) {
+	br := DefaultCBrotliReaderPool.Get()
+	if err := br.Reset(src); err != nil {
+		_ = br.Close()
+		return nil, err
+	}
+	return br, nil
+}
+
+// putCgoReader gives r back to its pool when it is a cgo decoder.
+func putCgoReader(r io.Reader) bool {
+	br, ok := r.(*CBrotliReader)
+	if ok {
+		DefaultCBrotliReaderPool.Put(br)
+	}
+	return ok
+}
+
+func cgoStats() []PoolStats {
+	return []PoolStats{{Name: Br, Levels: DefaultCBrotliCompressPools.Stats()}}
+}
+
+func cgoEncoderCost(w Writer, level int) (int64, bool) {
+	if _, ok := w.(*cbrotli.WWriter); !ok {
+		return 0, false
+	}
+	// ring buffer of the default 4MB window plus the hashers, which grow with
+	// the quality.
+	switch {
+	case level <= 1:
+		return 1 << 20, true
+	case level <= 4:
+		return 6 << 20, true
+	case level <= 9:
+		return 12 << 20, true
+	}
+	return 24 << 20, true
+}
+
+func cgoDrain() int {
+	return DefaultCBrotliCompressPools.Drain() + DefaultCBrotliReaderPool.Drain()
+}
+
+// destroyWriter frees what an encoder holds outside the Go heap.
+func destroyWriter(w Writer) {
+	if cw, ok := w.(*cbrotli.WWriter); ok {
+		runtime.SetFinalizer(cw, nil)
+		cw.Destroy()
+	}
+}
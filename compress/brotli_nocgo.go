@@ -0,0 +1,47 @@
+//go:build !cgo
+
+package compress
+
+import (
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/newacorn/brotli/matchfinder"
+	"io"
+)
+
+// Without cgo Br is served by the pure go brotli pools, the cbrotli ones do
+// not exist.
+
+const cgoBrotli = false
+
+type comWriter interface {
+	*gzip.Writer | *zlib.Writer | *matchfinder.Writer | *zstd.Encoder | *s2.Writer
+}
+
+func cbrotliPool(int) Pooler {
+	return nil
+}
+
+func cbrotliReader(io.Reader) (io.Reader, error) {
+	return nil, ErrNoCgo
+}
+
+func putCgoReader(io.Reader) bool {
+	return false
+}
+
+func cgoStats() []PoolStats {
+	return nil
+}
+
+func cgoEncoderCost(Writer, int) (int64, bool) {
+	return 0, false
+}
+
+func destroyWriter(Writer) {}
+
+func cgoDrain() int {
+	return 0
+}
@@ -0,0 +1,75 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/brotli/matchfinder"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSetBrotliImpl(t *testing.T) {
+	defer func() { _ = SetBrotliImpl(BrotliAuto) }()
+	src := strings.Repeat("brotli without cgo ", 300)
+	if cgoBrotli {
+		assert.Eq(t, BrotliCgo, CurrentBrotliImpl())
+		assert.NoErr(t, SetBrotliImpl(BrotliCgo))
+	} else {
+		assert.Eq(t, BrotliPure, CurrentBrotliImpl())
+		assert.ErrIs(t, SetBrotliImpl(BrotliCgo), ErrNoCgo)
+	}
+	native := compressForTest(t, Br, 5, []byte(src))
+	assert.ErrIs(t, SetBrotliImpl(BrotliPure+1), ErrUnknownBrotliImpl)
+	assert.Eq(t, "unknown", (BrotliPure + 1).String())
+	//
+	assert.NoErr(t, SetBrotliImpl(BrotliPure))
+	assert.Eq(t, "pure", CurrentBrotliImpl().String())
+	w := Pool(5, Br).Get()
+	_, ok := w.(*matchfinder.Writer)
+	assert.True(t, ok)
+	Pool(5, Br).Put(w)
+	pure := compressForTest(t, Br, 5, []byte(src))
+	// either implementation decodes the other's output.
+	impls := []BrotliImpl{BrotliPure}
+	if cgoBrotli {
+		impls = append(impls, BrotliCgo)
+	}
+	for _, impl := range impls {
+		assert.NoErr(t, SetBrotliImpl(impl))
+		for _, c := range [][]byte{native, pure} {
+			r, err := NewReader(Br, strings.NewReader(string(c)))
+			assert.NoErr(t, err)
+			rs, err := io.ReadAll(r)
+			assert.NoErr(t, err)
+			assert.Eq(t, src, string(rs))
+			assert.NoErr(t, r.Close())
+		}
+	}
+}
+
+func TestBrotliTruncated(t *testing.T) {
+	defer func() { _ = SetBrotliImpl(BrotliAuto) }()
+	src := strings.Repeat("a stream cut short ", 300)
+	c := compressForTest(t, Br, 5, []byte(src))
+	impls := []BrotliImpl{BrotliPure}
+	if cgoBrotli {
+		impls = append(impls, BrotliCgo)
+	}
+	for _, impl := range impls {
+		assert.NoErr(t, SetBrotliImpl(impl))
+		r, err := NewReader(Br, strings.NewReader(string(c[:len(c)-3])))
+		assert.NoErr(t, err)
+		_, err = io.ReadAll(r)
+		assert.ErrIs(t, err, io.ErrUnexpectedEOF, impl.String())
+		assert.NoErr(t, r.Close())
+		// the pooled decoder serves the next streams.
+		for i := 0; i < 3; i++ {
+			r, err = NewReader(Br, strings.NewReader(string(c)))
+			assert.NoErr(t, err)
+			rs, err := io.ReadAll(r)
+			assert.NoErr(t, err, impl.String())
+			assert.Eq(t, src, string(rs))
+			assert.NoErr(t, r.Close())
+		}
+	}
+}
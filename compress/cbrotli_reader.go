@@ -0,0 +1,360 @@
+//go:build cgo
+
+package compress
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+// The decoder of libbrotlidec, which is linked by the cbrotli package behind
+// the writers. It's declared here instead of including brotli/decode.h so that
+// nothing is asked of the build beyond what cbrotli already needs.
+typedef struct BrotliDecoderStateStruct BrotliDecoderState;
+
+typedef enum {
+	BROTLI_DECODER_RESULT_ERROR = 0,
+	BROTLI_DECODER_RESULT_SUCCESS = 1,
+	BROTLI_DECODER_RESULT_NEEDS_MORE_INPUT = 2,
+	BROTLI_DECODER_RESULT_NEEDS_MORE_OUTPUT = 3
+} BrotliDecoderResult;
+
+typedef int BrotliDecoderErrorCode;
+
+typedef void* (*brotli_alloc_func)(void* opaque, size_t size);
+typedef void (*brotli_free_func)(void* opaque, void* address);
+
+BrotliDecoderState* BrotliDecoderCreateInstance(brotli_alloc_func alloc_func,
+                                                brotli_free_func free_func, void* opaque);
+void BrotliDecoderDestroyInstance(BrotliDecoderState* state);
+BrotliDecoderResult BrotliDecoderDecompressStream(BrotliDecoderState* state,
+                                                  size_t* available_in, const uint8_t** next_in,
+                                                  size_t* available_out, uint8_t** next_out,
+                                                  size_t* total_out);
+int BrotliDecoderHasMoreOutput(const BrotliDecoderState* state);
+int BrotliDecoderIsUsed(const BrotliDecoderState* state);
+int BrotliDecoderIsFinished(const BrotliDecoderState* state);
+BrotliDecoderErrorCode BrotliDecoderGetErrorCode(const BrotliDecoderState* state);
+const char* BrotliDecoderErrorString(BrotliDecoderErrorCode c);
+
+// An arena keeps the blocks freed by the decoder of one reader, the decoder
+// built by the next Reset takes them back instead of calling malloc. Each
+// block is preceded by its capacity.
+#define ARENA_SLOTS 16
+#define ARENA_HEADER 16
+
+typedef struct {
+	void* ptr[ARENA_SLOTS];
+	size_t cap[ARENA_SLOTS];
+} arena;
+
+static void* arena_alloc(void* opaque, size_t size) {
+	arena* a = (arena*)opaque;
+	int best = -1;
+	for (int i = 0; i < ARENA_SLOTS; i++) {
+		// a block at most twice the size asked for.
+		if (a->ptr[i] != NULL && a->cap[i] >= size && a->cap[i] / 2 <= size &&
+			(best < 0 || a->cap[i] < a->cap[best])) {
+			best = i;
+		}
+	}
+	if (best >= 0) {
+		void* p = a->ptr[best];
+		a->ptr[best] = NULL;
+		return p;
+	}
+	char* h = (char*)malloc(size + ARENA_HEADER);
+	if (h == NULL) {
+		return NULL;
+	}
+	*(size_t*)h = size;
+	return h + ARENA_HEADER;
+}
+
+static void arena_free(void* opaque, void* p) {
+	if (p == NULL) {
+		return;
+	}
+	arena* a = (arena*)opaque;
+	for (int i = 0; i < ARENA_SLOTS; i++) {
+		if (a->ptr[i] == NULL) {
+			a->ptr[i] = p;
+			a->cap[i] = *(size_t*)((char*)p - ARENA_HEADER);
+			return;
+		}
+	}
+	free((char*)p - ARENA_HEADER);
+}
+
+static arena* arena_new(void) {
+	return (arena*)calloc(1, sizeof(arena));
+}
+
+static void arena_destroy(arena* a) {
+	for (int i = 0; i < ARENA_SLOTS; i++) {
+		if (a->ptr[i] != NULL) {
+			free((char*)a->ptr[i] - ARENA_HEADER);
+		}
+	}
+	free(a);
+}
+
+static BrotliDecoderState* arena_decoder(arena* a) {
+	return BrotliDecoderCreateInstance(arena_alloc, arena_free, a);
+}
+
+static BrotliDecoderResult decompress_stream(BrotliDecoderState* s,
+                                             uint8_t* out, size_t out_len,
+                                             const uint8_t* in, size_t in_len,
+                                             size_t* bytes_written,
+                                             size_t* bytes_consumed, int* has_more) {
+	size_t in_remaining = in_len;
+	size_t out_remaining = out_len;
+	BrotliDecoderResult result = BrotliDecoderDecompressStream(
+		s, &in_remaining, &in, &out_remaining, &out, NULL);
+	*bytes_written = out_len - out_remaining;
+	*bytes_consumed = in_len - in_remaining;
+	*has_more = BrotliDecoderHasMoreOutput(s);
+	return result;
+}
+*/
+import "C"
+import (
+	"errors"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io"
+	"sync"
+	"unsafe"
+)
+
+// DefaultCBrotliMaxIdle idle decoders kept by a CBrotliReaderPool with MaxIdle unset.
+const DefaultCBrotliMaxIdle = 64
+
+// cbrotliReadBufSize compressed bytes read from the source at once.
+const cbrotliReadBufSize = 32 << 10
+
+var (
+	errCBrotliExcessiveInput = errors.New("compress: brotli: excessive input")
+	errCBrotliInvalidState   = errors.New("compress: brotli: invalid state")
+	errCBrotliNoMemory       = errors.New("compress: brotli: decoder allocation failed")
+)
+
+// CBrotliReader cgo brotli decoder that can be Reset onto a new stream. The
+// decoder state is rebuilt from the blocks the previous one freed, a reused
+// reader makes no C allocation. A stream ending before the brotli end marker
+// fails with io.ErrUnexpectedEOF.
+//
+// It's its own binding rather than cbrotli.ReaderV2: libbrotlidec has no way
+// to restart a decoder, and ReaderV2 exposes neither its state nor the
+// allocator, so a ReaderV2 can only ever decode one stream.
+type CBrotliReader struct {
+	src     io.Reader
+	state   *C.BrotliDecoderState
+	arena   *C.arena
+	buf     *bpool.Bytes
+	in      []byte
+	hasMore bool
+}
+
+// NewCBrotliReader decodes src, Close frees the native decoder.
+func NewCBrotliReader(src io.Reader) *CBrotliReader {
+	r := &CBrotliReader{src: src, arena: C.arena_new()}
+	if r.arena != nil {
+		r.state = C.arena_decoder(r.arena)
+	}
+	r.buf = bpool.Get(cbrotliReadBufSize)
+	r.buf.B = r.buf.B[:cbrotliReadBufSize]
+	return r
+}
+
+// Reset starts a new stream read from src, a decoder that was used is rebuilt.
+func (r *CBrotliReader) Reset(src io.Reader) error {
+	if r.arena == nil {
+		return errReaderClosed
+	}
+	if r.state == nil || C.BrotliDecoderIsUsed(r.state) != 0 {
+		if r.state != nil {
+			C.BrotliDecoderDestroyInstance(r.state)
+		}
+		if r.state = C.arena_decoder(r.arena); r.state == nil {
+			return errCBrotliNoMemory
+		}
+	}
+	r.src = src
+	r.in = nil
+	r.hasMore = false
+	return nil
+}
+
+func (r *CBrotliReader) Read(p []byte) (n int, err error) {
+	if r.state == nil {
+		if r.arena == nil {
+			return 0, errReaderClosed
+		}
+		return 0, errCBrotliNoMemory
+	}
+	if !r.hasMore && len(r.in) == 0 {
+		if C.BrotliDecoderIsFinished(r.state) != 0 {
+			return 0, io.EOF
+		}
+		m, readErr := r.src.Read(r.buf.B)
+		if m == 0 {
+			if readErr == io.EOF {
+				readErr = io.ErrUnexpectedEOF
+			}
+			return 0, readErr
+		}
+		r.in = r.buf.B[:m]
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		var written, consumed C.size_t
+		var hasMore C.int
+		var data *C.uint8_t
+		if len(r.in) != 0 {
+			data = (*C.uint8_t)(unsafe.Pointer(&r.in[0]))
+		}
+		result := C.decompress_stream(r.state,
+			(*C.uint8_t)(unsafe.Pointer(&p[0])), C.size_t(len(p)),
+			data, C.size_t(len(r.in)),
+			&written, &consumed, &hasMore)
+		r.in = r.in[int(consumed):]
+		n = int(written)
+		r.hasMore = hasMore != 0
+		switch result {
+		case C.BROTLI_DECODER_RESULT_SUCCESS:
+			if len(r.in) > 0 {
+				return n, errCBrotliExcessiveInput
+			}
+			return n, nil
+		case C.BROTLI_DECODER_RESULT_ERROR:
+			code := C.BrotliDecoderGetErrorCode(r.state)
+			return n, errors.New("compress: brotli: " + C.GoString(C.BrotliDecoderErrorString(code)))
+		case C.BROTLI_DECODER_RESULT_NEEDS_MORE_OUTPUT:
+			if n == 0 {
+				return 0, io.ErrShortBuffer
+			}
+			return n, nil
+		}
+		// BROTLI_DECODER_RESULT_NEEDS_MORE_INPUT
+		if len(r.in) != 0 {
+			return 0, errCBrotliInvalidState
+		}
+		// r.src.Read may block, return what is decoded first.
+		if n > 0 {
+			return n, nil
+		}
+		m, readErr := r.src.Read(r.buf.B)
+		if m == 0 {
+			if readErr == io.EOF {
+				readErr = io.ErrUnexpectedEOF
+			}
+			return 0, readErr
+		}
+		r.in = r.buf.B[:m]
+	}
+}
+
+// Close frees the native decoder and gives the read buffer back, r can not be
+// used afterward.
+func (r *CBrotliReader) Close() error {
+	if r.arena == nil {
+		return errReaderClosed
+	}
+	if r.state != nil {
+		C.BrotliDecoderDestroyInstance(r.state)
+		r.state = nil
+	}
+	C.arena_destroy(r.arena)
+	r.arena = nil
+	bpool.Put(r.buf)
+	r.buf = nil
+	r.src = nil
+	r.in = nil
+	return nil
+}
+
+// CBrotliReaderPool keeps idle *CBrotliReader for reuse. Get used to return a
+// new *cbrotli.ReaderV2, which could not be reused, see CBrotliReader.
+//
+// Unlike sync.Pool nothing is dropped at GC, at most MaxIdle readers are kept and
+// the rest are closed on Put, so the native decoder state is always freed by
+// Close and never left to a finalizer. The zero value is ready to use.
+type CBrotliReaderPool struct {
+	// MaxIdle 0 means DefaultCBrotliMaxIdle, negative keeps nothing.
+	MaxIdle int
+	mu      sync.Mutex
+	idle    []*CBrotliReader
+}
+
+// Get returns an idle reader or a new one, Reset it onto the source before use.
+func (b *CBrotliReaderPool) Get() (r *CBrotliReader) {
+	b.mu.Lock()
+	if n := len(b.idle); n > 0 {
+		r = b.idle[n-1]
+		b.idle[n-1] = nil
+		b.idle = b.idle[:n-1]
+	}
+	b.mu.Unlock()
+	if r == nil {
+		r = NewCBrotliReader(nil)
+	}
+	return
+}
+
+// Put resets r and keeps it for the next Get. A reader already closed is
+// dropped, one over MaxIdle is closed.
+func (b *CBrotliReaderPool) Put(r *CBrotliReader) {
+	if r == nil || r.arena == nil {
+		return
+	}
+	if r.Reset(nil) != nil {
+		_ = r.Close()
+		return
+	}
+	b.mu.Lock()
+	if len(b.idle) < b.maxIdle() {
+		b.idle = append(b.idle, r)
+		r = nil
+	}
+	b.mu.Unlock()
+	if r != nil {
+		_ = r.Close()
+	}
+}
+
+// Prewarm adds up to n new readers, without going past MaxIdle.
+func (b *CBrotliReaderPool) Prewarm(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := 0; i < n && len(b.idle) < b.maxIdle(); i++ {
+		b.idle = append(b.idle, NewCBrotliReader(nil))
+	}
+}
+
+// Drain closes the idle readers, drained is their number.
+func (b *CBrotliReaderPool) Drain() (drained int) {
+	b.mu.Lock()
+	idle := b.idle
+	b.idle = nil
+	b.mu.Unlock()
+	for _, r := range idle {
+		_ = r.Close()
+	}
+	return len(idle)
+}
+
+// Idle number of readers waiting for Get.
+func (b *CBrotliReaderPool) Idle() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.idle)
+}
+
+func (b *CBrotliReaderPool) maxIdle() int {
+	if b.MaxIdle == 0 {
+		return DefaultCBrotliMaxIdle
+	}
+	return b.MaxIdle
+}
@@ -0,0 +1,89 @@
+//go:build cgo
+
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/goutils/bytes"
+	"github.com/xyproto/randomstring"
+	"io"
+	"testing"
+)
+
+func TestCBrotliReaderPoolReuse(t *testing.T) {
+	pool := CBrotliReaderPool{}
+	var first *CBrotliReader
+	for i := 0; i < 5; i++ {
+		dataBytes := []byte(randomstring.HumanFriendlyString(1000 + i*3000))
+		compressed := compressForTest(t, Br, 5, dataBytes)
+		r := pool.Get()
+		if first == nil {
+			first = r
+		}
+		// the same decoder serves every stream.
+		assert.Eq(t, first, r)
+		assert.NoErr(t, r.Reset(bytes.NewBuffer(compressed)))
+		if i == 2 {
+			// abandon the stream half way.
+			_, err := r.Read(make([]byte, 10))
+			assert.NoErr(t, err)
+			pool.Put(r)
+			continue
+		}
+		rs, err := io.ReadAll(r)
+		assert.NoErr(t, err)
+		assert.Eq(t, dataBytes, rs)
+		pool.Put(r)
+	}
+	assert.Eq(t, 1, pool.Idle())
+}
+
+func TestCBrotliReaderPoolMaxIdle(t *testing.T) {
+	pool := CBrotliReaderPool{MaxIdle: 2}
+	rs := []*CBrotliReader{pool.Get(), pool.Get(), pool.Get()}
+	for _, r := range rs {
+		pool.Put(r)
+	}
+	assert.Eq(t, 2, pool.Idle())
+	// the one over the limit has been closed.
+	_, err := rs[2].Read(make([]byte, 1))
+	assert.Err(t, err)
+	//
+	closed := pool.Get()
+	assert.NoErr(t, closed.Close())
+	pool.Put(closed)
+	assert.Eq(t, 1, pool.Idle())
+}
+
+func TestCBrotliReaderPoolPrewarmDrain(t *testing.T) {
+	pool := CBrotliReaderPool{MaxIdle: 3}
+	pool.Prewarm(5)
+	assert.Eq(t, 3, pool.Idle())
+	assert.Eq(t, 3, pool.Drain())
+	assert.Eq(t, 0, pool.Idle())
+	//
+	DefaultCBrotliCompressPools.Prewarm(5, 2)
+	assert.Gt(t, DefaultCBrotliCompressPools.Drain(), 0)
+	compressed := compressForTest(t, Br, 5, []byte("after drain"))
+	r, err := NewReader(Br, bytes.NewBuffer(compressed))
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, "after drain", string(rs))
+	assert.NoErr(t, r.Close())
+}
+
+func TestCBrotliReaderTruncated(t *testing.T) {
+	dataBytes := []byte(randomstring.HumanFriendlyString(5000))
+	compressed := compressForTest(t, Br, 5, dataBytes)
+	r := NewCBrotliReader(bytes.NewBuffer(compressed[:len(compressed)/2]))
+	_, err := io.ReadAll(r)
+	assert.ErrIs(t, err, io.ErrUnexpectedEOF)
+	// the decoder rebuilt by Reset decodes a whole stream.
+	assert.NoErr(t, r.Reset(bytes.NewBuffer(compressed)))
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, dataBytes, rs)
+	assert.NoErr(t, r.Close())
+	assert.ErrIs(t, r.Reset(nil), errReaderClosed)
+}
@@ -0,0 +1,123 @@
+package compress
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// MaxContentCodings codings a Content-Encoding may stack.
+const MaxContentCodings = 4
+
+// ErrTooManyCodings Content-Encoding lists more than MaxContentCodings codings.
+var ErrTooManyCodings = errors.New("compress: too many content codings")
+
+// UnknownCodingError a Content-Encoding token without decoder, errors.Is
+// matches it with ErrUnsupportedOrder.
+type UnknownCodingError struct {
+	Coding string
+}
+
+func (e *UnknownCodingError) Error() string {
+	return "compress: unknown content coding " + `"` + e.Coding + `"`
+}
+
+func (e *UnknownCodingError) Is(target error) bool {
+	return target == ErrUnsupportedOrder
+}
+
+// ParseContentEncoding the codings of the Content-Encoding values, in the
+// order they were applied. identity is dropped, x-gzip is Gzip.
+func ParseContentEncoding(values ...string) ([]Order, error) {
+	var orders []Order
+	for _, v := range values {
+		for v != "" {
+			var token string
+			token, v, _ = strings.Cut(v, ",")
+			token = strings.TrimSpace(token)
+			if token == "" {
+				continue
+			}
+			order, ok := contentCoding(token)
+			if !ok {
+				return nil, &UnknownCodingError{Coding: token}
+			}
+			if order == Identity {
+				continue
+			}
+			if len(orders) == MaxContentCodings {
+				return nil, ErrTooManyCodings
+			}
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func contentCoding(token string) (Order, bool) {
+	for _, o := range [...]Order{Gzip, Br, Zstd, Deflate, Identity} {
+		if strings.EqualFold(token, string(o)) {
+			return o, true
+		}
+	}
+	if strings.EqualFold(token, "x-gzip") {
+		return Gzip, true
+	}
+	return "", false
+}
+
+// NewContentDecoder decodes src, a body with the Content-Encoding values, e.g.
+// h.Values("Content-Encoding"). The pooled decoders are chained from the last
+// coding applied to the first, Close gives each of them back to its pool but
+// does not close src. A body without coding is returned as is, with a no-op
+// Close.
+func NewContentDecoder(src io.Reader, contentEncoding ...string) (io.ReadCloser, error) {
+	orders, err := ParseContentEncoding(contentEncoding...)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return io.NopCloser(src), nil
+	}
+	if len(orders) == 1 {
+		return NewReader(orders[0], src)
+	}
+	c := &chainReader{}
+	r := src
+	for i := len(orders) - 1; i >= 0; i-- {
+		rc, err := NewReader(orders[i], r)
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		c.layers = append(c.layers, rc)
+		r = rc
+	}
+	return c, nil
+}
+
+// chainReader layers of decoders, the innermost first.
+type chainReader struct {
+	layers []io.ReadCloser
+}
+
+func (c *chainReader) Read(p []byte) (int, error) {
+	if len(c.layers) == 0 {
+		return 0, errReaderClosed
+	}
+	return c.layers[len(c.layers)-1].Read(p)
+}
+
+// Close closes the outermost layer first, each reads from the previous one.
+func (c *chainReader) Close() (err error) {
+	if c.layers == nil {
+		return errReaderClosed
+	}
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		if e := c.layers[i].Close(); err == nil {
+			err = e
+		}
+	}
+	c.layers = nil
+	return
+}
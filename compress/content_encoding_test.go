@@ -0,0 +1,58 @@
+package compress
+
+import (
+	"errors"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/goutils/bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNewContentDecoder(t *testing.T) {
+	src := []byte(strings.Repeat("stacked codings ", 200))
+	for _, tc := range []struct {
+		values []string
+		orders []Order
+	}{
+		{[]string{"gzip, br"}, []Order{Gzip, Br}},
+		{[]string{"X-Gzip , identity", "ZSTD"}, []Order{Gzip, Zstd}},
+		{[]string{"deflate,gzip,zstd"}, []Order{Deflate, Gzip, Zstd}},
+		{[]string{"br"}, []Order{Br}},
+		{[]string{"", "identity"}, nil},
+	} {
+		orders, err := ParseContentEncoding(tc.values...)
+		assert.NoErr(t, err)
+		assert.Eq(t, tc.orders, orders)
+		body := src
+		for _, o := range orders {
+			body = compressForTest(t, o, -1, body)
+		}
+		for i := 0; i < 2; i++ {
+			r, err := NewContentDecoder(bytes.NewBuffer(body), tc.values...)
+			assert.NoErr(t, err)
+			rs, err := io.ReadAll(r)
+			assert.NoErr(t, err)
+			assert.Eq(t, src, rs)
+			assert.NoErr(t, r.Close())
+			if len(orders) > 1 {
+				assert.Err(t, r.Close())
+			}
+		}
+	}
+}
+
+func TestNewContentDecoderErrors(t *testing.T) {
+	_, err := NewContentDecoder(strings.NewReader("x"), "gzip, compress")
+	var ue *UnknownCodingError
+	assert.True(t, errors.As(err, &ue))
+	assert.Eq(t, "compress", ue.Coding)
+	assert.ErrIs(t, err, ErrUnsupportedOrder)
+	//
+	_, err = NewContentDecoder(strings.NewReader("x"), "gzip,gzip,gzip,gzip,gzip")
+	assert.ErrIs(t, err, ErrTooManyCodings)
+	// the gzip layer can not read its header out of plain text.
+	body := compressForTest(t, Zstd, -1, []byte("not gzip"))
+	_, err = NewContentDecoder(bytes.NewBuffer(body), "gzip, zstd")
+	assert.Err(t, err)
+}
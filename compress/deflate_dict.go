@@ -0,0 +1,104 @@
+package compress
+
+import (
+	"errors"
+	"github.com/klauspost/compress/zlib"
+	"hash/adler32"
+	"io"
+	"sync"
+)
+
+// ErrNoDict the zlib stream does not use a preset dictionary.
+var ErrNoDict = errors.New("compress: stream has no preset dictionary")
+
+// DeflateDictPools zlib writer pools built with a preset dictionary, the
+// writers emit the streams DefaultDeflateReaderDictPool and
+// DeflateReader.ResetDict consume. The embedded PoolContainer is used like
+// DefaultDeflateCompressPools.
+type DeflateDictPools struct {
+	*PoolContainer[*zlib.Writer]
+	id   uint32
+	dict []byte
+}
+
+// NewDeflateDictPools dict is arbitrary data, the most useful at its end.
+// It must not be modified afterward.
+func NewDeflateDictPools(dict []byte) *DeflateDictPools {
+	d := &DeflateDictPools{
+		PoolContainer: &PoolContainer[*zlib.Writer]{
+			defaultLevel: zlib.DefaultCompression,
+			offset:       2,
+			poolsInit:    deflatePoolsInit(dict),
+		},
+		id:   adler32.Checksum(dict),
+		dict: dict,
+	}
+	d.init()
+	return d
+}
+
+// ID the DICTID written in the zlib header, the Adler-32 of the dictionary.
+func (d *DeflateDictPools) ID() uint32 {
+	return d.id
+}
+
+// Dict the preset dictionary.
+func (d *DeflateDictPools) Dict() []byte {
+	return d.dict
+}
+
+// NewReader is the NewReader of Deflate for streams written with d's dictionary.
+func (d *DeflateDictPools) NewReader(src io.Reader) (io.ReadCloser, error) {
+	return newDeflateReader(src, d.dict)
+}
+
+// DeflateDicts deflate dictionary pools by DICTID. The zero value is ready to use.
+type DeflateDicts struct {
+	mu    sync.RWMutex
+	pools map[uint32]*DeflateDictPools
+}
+
+// DefaultDeflateDicts process wide registry of preset dictionaries.
+var DefaultDeflateDicts DeflateDicts
+
+// Register makes pools for dict, replacing those of a dictionary with the same ID.
+func (d *DeflateDicts) Register(dict []byte) *DeflateDictPools {
+	p := NewDeflateDictPools(dict)
+	d.mu.Lock()
+	if d.pools == nil {
+		d.pools = make(map[uint32]*DeflateDictPools)
+	}
+	d.pools[p.id] = p
+	d.mu.Unlock()
+	return p
+}
+
+// Get the pools of dictionary id, nil when not registered.
+func (d *DeflateDicts) Get(id uint32) *DeflateDictPools {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.pools[id]
+}
+
+// Unregister forgets dictionary id.
+func (d *DeflateDicts) Unregister(id uint32) {
+	d.mu.Lock()
+	delete(d.pools, id)
+	d.mu.Unlock()
+}
+
+// DeflateStreamDictID the DICTID in the zlib header at the start of head.
+// ErrNoDict when the stream has no preset dictionary.
+func DeflateStreamDictID(head []byte) (uint32, error) {
+	if len(head) < 2 || head[0]&0x0f != 8 || (uint16(head[0])<<8|uint16(head[1]))%31 != 0 {
+		return 0, zlib.ErrHeader
+	}
+	// FDICT flag (RFC 1950 section 2.2).
+	if head[1]&0x20 == 0 {
+		return 0, ErrNoDict
+	}
+	if len(head) < 6 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return uint32(head[2])<<24 | uint32(head[3])<<16 | uint32(head[4])<<8 | uint32(head[5]), nil
+}
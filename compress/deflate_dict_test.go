@@ -0,0 +1,54 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/klauspost/compress/zlib"
+	"github.com/newacorn/goutils/bytes"
+	"io"
+	"testing"
+)
+
+func TestDeflateDictPools(t *testing.T) {
+	dict := []byte(`{"user":{"name":"","email":"@example.com","active":true},"roles":["reader","writer"]}`)
+	payload := []byte(`{"user":{"name":"bob","email":"bob@example.com","active":true},"roles":["reader"]}`)
+	pools := DefaultDeflateDicts.Register(dict)
+	defer DefaultDeflateDicts.Unregister(pools.ID())
+	assert.Eq(t, pools, DefaultDeflateDicts.Get(pools.ID()))
+	//
+	plain := compressForTest(t, Deflate, zlib.BestCompression, payload)
+	for i := 0; i < 3; i++ {
+		p := pools.Pool(zlib.BestCompression)
+		w := p.Get()
+		buf := bytes.Buffer{}
+		w.Reset(&buf)
+		_, err := w.Write(payload)
+		assert.NoErr(t, err)
+		assert.NoErr(t, w.Close())
+		p.Put(w)
+		withDict := buf.Bytes()
+		assert.Lt(t, len(withDict), len(plain))
+		//
+		id, err := DeflateStreamDictID(withDict)
+		assert.NoErr(t, err)
+		assert.Eq(t, pools.ID(), id)
+		// both the pooled reader and the raw dictionary pool decode it.
+		r, err := DefaultDeflateDicts.Get(id).NewReader(bytes.NewBuffer(withDict))
+		assert.NoErr(t, err)
+		rs, err := io.ReadAll(r)
+		assert.NoErr(t, err)
+		assert.Eq(t, payload, rs)
+		assert.NoErr(t, r.Close())
+		//
+		dr := DefaultDeflateReaderDictPool.Get().(DeflateReader)
+		assert.NoErr(t, dr.ResetDict(bytes.NewBuffer(withDict), dict))
+		rs, err = io.ReadAll(dr)
+		assert.NoErr(t, err)
+		assert.Eq(t, payload, rs)
+		assert.NoErr(t, dr.Close())
+		DefaultDeflateReaderDictPool.Put(dr)
+	}
+	_, err := DeflateStreamDictID(plain)
+	assert.ErrIs(t, err, ErrNoDict)
+	_, err = DeflateStreamDictID([]byte("xx"))
+	assert.ErrIs(t, err, zlib.ErrHeader)
+}
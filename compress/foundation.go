@@ -87,7 +87,11 @@ func Pool(level int, order Order) Pooler {
 	case Zstd:
 		return DefaultZstdCompressPools.Pool(level)
 	case Br:
-		return DefaultCBrotliCompressPools.Pool(level)
+		return brotliPool(level)
+	case Snappy:
+		return DefaultSnappyCompressPools.Pool(level)
+	case S2:
+		return DefaultS2CompressPools.Pool(level)
 	}
 	return nil
 }
@@ -144,6 +148,9 @@ const applicationMinLen = len("application/xml")
 const textMinLen = len("text/csv")
 const imageMinLen = len("image/svg+xml")
 
+// CheckMimeOk matches the types of compressedMimes by the first 4 bytes of the
+// subtype, the list is kept to the types compressed so far. DefaultMimeMatcher
+// compares types in full and knows more of them.
 func CheckMimeOk(mime []byte) (ok bool) {
 	l := len(mime)
 	if l < 4 {
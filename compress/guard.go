@@ -0,0 +1,269 @@
+package compress
+
+import (
+	"bufio"
+	"errors"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io"
+)
+
+const (
+	// DefaultGuardProbeSize bytes buffered for the trial compression.
+	DefaultGuardProbeSize = 4 << 10
+	// DefaultGuardMaxRatio highest compressed/original ratio worth compressing.
+	DefaultGuardMaxRatio = 0.9
+)
+
+var errWriterClosed = errors.New("compress: write on closed writer")
+
+// GuardOptions configures NewGuardWriter, the zero value is ready to use.
+type GuardOptions struct {
+	// ProbeSize bytes trial-compressed, 0 means DefaultGuardProbeSize.
+	ProbeSize int
+	// MaxRatio compressed/original size above which identity is used,
+	// 0 means DefaultGuardMaxRatio.
+	MaxRatio float64
+	// OnDecide is called once, before anything is written to dst, with
+	// whether the output is compressed. An HTTP layer sets Content-Encoding
+	// there.
+	OnDecide func(compressed bool)
+}
+
+// GuardWriter writes to dst compressed with a writer of pool only when it is
+// worth it. The first ProbeSize bytes are buffered and trial-compressed, when
+// they do not shrink below MaxRatio everything is written as is.
+type GuardWriter struct {
+	dst  io.Writer
+	pool Pooler
+	opts GuardOptions
+	buf  *bpool.Bytes
+	w    Writer
+	bw   *bufio.Writer
+	// out where w writes, the trial buffer until the output is committed.
+	out        countWriter
+	in         int64
+	err        error
+	decided    bool
+	compressed bool
+	closed     bool
+}
+
+var _ Writer = (*GuardWriter)(nil)
+
+// NewGuardWriter pool is the one of the Order used when compressing.
+func NewGuardWriter(dst io.Writer, pool Pooler, opts GuardOptions) *GuardWriter {
+	if opts.ProbeSize <= 0 {
+		opts.ProbeSize = DefaultGuardProbeSize
+	}
+	if opts.MaxRatio == 0 {
+		opts.MaxRatio = DefaultGuardMaxRatio
+	}
+	return &GuardWriter{dst: dst, pool: pool, opts: opts}
+}
+
+// Decided reports whether the decision has been made.
+func (g *GuardWriter) Decided() bool {
+	return g.decided
+}
+
+// Compressed reports whether the output is compressed, false until Decided.
+func (g *GuardWriter) Compressed() bool {
+	return g.compressed
+}
+
+func (g *GuardWriter) Write(p []byte) (int, error) {
+	if g.closed {
+		return 0, errWriterClosed
+	}
+	if g.err != nil {
+		return 0, g.err
+	}
+	g.in += int64(len(p))
+	if g.decided {
+		if g.compressed {
+			return g.w.Write(p)
+		}
+		return g.dst.Write(p)
+	}
+	if g.buf == nil {
+		g.buf = bpool.Get(g.opts.ProbeSize)
+	}
+	_, _ = g.buf.Write(p)
+	if g.buf.Len() >= g.opts.ProbeSize {
+		if err := g.decide(false); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush decides with what has been buffered when still undecided, and flushes
+// the compressed stream.
+func (g *GuardWriter) Flush() error {
+	if g.closed {
+		return errWriterClosed
+	}
+	if g.err != nil {
+		return g.err
+	}
+	if !g.decided {
+		if err := g.decide(false); err != nil {
+			return err
+		}
+	}
+	if !g.compressed {
+		return nil
+	}
+	if err := g.w.Flush(); err != nil {
+		return err
+	}
+	if g.bw != nil {
+		return g.bw.Flush()
+	}
+	return nil
+}
+
+// Close completes the stream and gives the writer back to the pool, it does
+// not close dst. An empty output is never compressed. An error of the decision
+// is returned again.
+func (g *GuardWriter) Close() (err error) {
+	if g.closed {
+		return errWriterClosed
+	}
+	g.closed = true
+	switch {
+	case g.err != nil:
+		err = g.err
+	case !g.decided:
+		err = g.decide(true)
+	case g.compressed:
+		err = g.w.Close()
+		putWriter(g.pool, g.w, err == nil)
+		g.w = nil
+		if g.bw != nil && err == nil {
+			err = g.bw.Flush()
+		}
+		RecordBytes(g.pool, g.in, g.out.n)
+	}
+	g.release()
+	return
+}
+
+// Reset discards the state, g then writes to dst.
+func (g *GuardWriter) Reset(dst io.Writer) {
+	g.release()
+	*g = GuardWriter{dst: dst, pool: g.pool, opts: g.opts}
+}
+
+// decide trial-compresses the buffer. final means nothing else is coming, the
+// trial output is then the whole stream. Otherwise the trial writer goes on
+// with the stream when it's compressed, its output so far is written to dst
+// first. An error is kept and returned by later calls.
+func (g *GuardWriter) decide(final bool) (err error) {
+	defer func() {
+		if err != nil {
+			g.err = err
+		}
+	}()
+	g.decided = true
+	var body []byte
+	if g.buf != nil {
+		body = g.buf.B
+	}
+	var trial *bpool.Bytes
+	var w Writer
+	if len(body) > 0 {
+		trial = bpool.Get(len(body)/2 + 64)
+		g.out.w = trial
+		w = g.pool.Get()
+		w.Reset(&g.out)
+		_, err = w.Write(body)
+		if err == nil {
+			if final {
+				err = w.Close()
+			} else {
+				err = w.Flush()
+			}
+		}
+		size := trial.Len()
+		if err == nil && size == 0 {
+			// Flush of the pure go brotli writer holds the output back, a
+			// second writer measures the probe.
+			size, err = g.closedTrialSize(body)
+		}
+		if err != nil {
+			destroyWriter(w)
+			bpool.Put(trial)
+			return
+		}
+		g.compressed = float64(size) <= float64(len(body))*g.opts.MaxRatio
+	}
+	if g.opts.OnDecide != nil {
+		g.opts.OnDecide(g.compressed)
+	}
+	switch {
+	case !g.compressed:
+		if w != nil {
+			// Reset of the cgo brotli writer keeps the encoder state, only a
+			// closed one goes back to the pool.
+			putWriter(g.pool, w, final || w.Close() == nil)
+		}
+		if len(body) > 0 {
+			_, err = g.dst.Write(body)
+		}
+	case final:
+		putWriter(g.pool, w, true)
+		_, err = g.dst.Write(trial.B)
+		RecordBytes(g.pool, int64(len(body)), int64(trial.Len()))
+	default:
+		g.w = w
+		out := g.dst
+		if g.pool.NeedBuffer() {
+			g.bw = bpool.GetBw(bpool.Block4k)
+			g.bw.Reset(g.dst)
+			out = g.bw
+		}
+		g.out.w = out
+		_, err = out.Write(trial.B)
+	}
+	if trial != nil {
+		bpool.Put(trial)
+	}
+	if g.buf != nil {
+		bpool.Put(g.buf)
+		g.buf = nil
+	}
+	return
+}
+
+// closedTrialSize length of body compressed by a writer of the pool.
+func (g *GuardWriter) closedTrialSize(body []byte) (size int, err error) {
+	trial := bpool.Get(len(body)/2 + 64)
+	w := g.pool.Get()
+	w.Reset(trial)
+	_, err = w.Write(body)
+	if err == nil {
+		err = w.Close()
+	}
+	putWriter(g.pool, w, err == nil)
+	size = trial.Len()
+	bpool.Put(trial)
+	return
+}
+
+// release drops what g holds, a writer still there did not complete its
+// stream and is destroyed.
+func (g *GuardWriter) release() {
+	if g.w != nil {
+		destroyWriter(g.w)
+		g.w = nil
+	}
+	if g.bw != nil {
+		bpool.PutBw(g.bw)
+		g.bw = nil
+	}
+	if g.buf != nil {
+		bpool.Put(g.buf)
+		g.buf = nil
+	}
+}
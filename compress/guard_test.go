@@ -0,0 +1,151 @@
+package compress
+
+import (
+	"crypto/rand"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/goutils/bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestGuardWriter(t *testing.T) {
+	text := []byte(strings.Repeat("compressible text, ", 1000))
+	noise := make([]byte, 20000)
+	_, _ = rand.Read(noise)
+	for _, order := range []Order{Gzip, Zstd, Br} {
+		for _, tc := range []struct {
+			name       string
+			src        []byte
+			chunk      int
+			compressed bool
+		}{
+			{"text", text, 1000, true},
+			{"short text", text[:2000], 1000, true},
+			{"noise", noise, 3000, false},
+			{"empty", nil, 1, false},
+		} {
+			buf := bytes.Buffer{}
+			decisions := 0
+			g := NewGuardWriter(&buf, Pool(-1, order), GuardOptions{OnDecide: func(compressed bool) {
+				decisions++
+				assert.Eq(t, 0, buf.Len())
+			}})
+			for i := 0; i < len(tc.src); i += tc.chunk {
+				_, err := g.Write(tc.src[i:min(i+tc.chunk, len(tc.src))])
+				assert.NoErr(t, err)
+			}
+			assert.NoErr(t, g.Close())
+			assert.Eq(t, 1, decisions, tc.name)
+			assert.True(t, g.Decided())
+			assert.Eq(t, tc.compressed, g.Compressed(), tc.name)
+			_, err := g.Write([]byte("x"))
+			assert.Err(t, err)
+			//
+			var rs []byte
+			if g.Compressed() {
+				assert.Lt(t, buf.Len(), len(tc.src))
+				r, err := NewReader(order, &buf)
+				assert.NoErr(t, err)
+				rs, err = io.ReadAll(r)
+				assert.NoErr(t, err)
+				assert.NoErr(t, r.Close())
+			} else {
+				rs = buf.Bytes()
+			}
+			assert.Eq(t, string(tc.src), string(rs), tc.name)
+		}
+	}
+}
+
+func TestGuardWriterFlush(t *testing.T) {
+	buf := bytes.Buffer{}
+	g := NewGuardWriter(&buf, Pool(-1, Gzip), GuardOptions{ProbeSize: 1 << 20})
+	_, _ = g.Write([]byte(strings.Repeat("a", 100)))
+	assert.False(t, g.Decided())
+	assert.NoErr(t, g.Flush())
+	assert.True(t, g.Decided() && g.Compressed())
+	assert.Gt(t, buf.Len(), 0)
+	_, _ = g.Write([]byte(strings.Repeat("b", 100)))
+	assert.NoErr(t, g.Close())
+	r, err := NewReader(Gzip, &buf)
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.NoErr(t, r.Close())
+	assert.Eq(t, strings.Repeat("a", 100)+strings.Repeat("b", 100), string(rs))
+	//
+	buf.Reset()
+	g.Reset(&buf)
+	assert.False(t, g.Decided())
+	_, _ = g.Write([]byte("tiny"))
+	assert.NoErr(t, g.Close())
+	assert.False(t, g.Compressed())
+	assert.Eq(t, "tiny", buf.String())
+}
+
+func TestGuardWriterStreamStats(t *testing.T) {
+	text := []byte(strings.Repeat("compressible text, ", 1000))
+	for _, order := range []Order{Gzip, Br} {
+		p := Pool(2, order).(interface{ Stats() LevelStats })
+		before := p.Stats()
+		buf := bytes.Buffer{}
+		g := NewGuardWriter(&buf, Pool(2, order), GuardOptions{ProbeSize: 1000})
+		for i := 0; i < len(text); i += 700 {
+			_, err := g.Write(text[i:min(i+700, len(text))])
+			assert.NoErr(t, err)
+		}
+		assert.NoErr(t, g.Close())
+		assert.True(t, g.Compressed())
+		after := p.Stats()
+		assert.Eq(t, int64(len(text)), after.BytesIn-before.BytesIn)
+		assert.Eq(t, int64(buf.Len()), after.BytesOut-before.BytesOut)
+		r, err := NewReader(order, &buf)
+		assert.NoErr(t, err)
+		rs, err := io.ReadAll(r)
+		assert.NoErr(t, err)
+		assert.NoErr(t, r.Close())
+		assert.Eq(t, string(text), string(rs))
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestGuardWriterStickyError(t *testing.T) {
+	noise := make([]byte, 5000)
+	_, _ = rand.Read(noise)
+	g := NewGuardWriter(failWriter{}, Pool(-1, Gzip), GuardOptions{})
+	_, err := g.Write(noise)
+	assert.ErrIs(t, err, io.ErrClosedPipe)
+	_, err = g.Write([]byte("more"))
+	assert.ErrIs(t, err, io.ErrClosedPipe)
+	assert.ErrIs(t, g.Flush(), io.ErrClosedPipe)
+	assert.ErrIs(t, g.Close(), io.ErrClosedPipe)
+}
+
+func TestGuardWriterResetMidStream(t *testing.T) {
+	text := []byte(strings.Repeat("compressible text, ", 1000))
+	buf := bytes.Buffer{}
+	g := NewGuardWriter(&buf, Pool(3, Br), GuardOptions{ProbeSize: 1000})
+	_, err := g.Write(text)
+	assert.NoErr(t, err)
+	assert.True(t, g.Compressed())
+	// abandoned, the unfinished stream does not go on in the next writer.
+	for i := 0; i < 3; i++ {
+		buf.Reset()
+		g.Reset(&buf)
+		_, err = g.Write(text)
+		assert.NoErr(t, err)
+		assert.NoErr(t, g.Close())
+		r, err := NewReader(Br, &buf)
+		assert.NoErr(t, err)
+		rs, err := io.ReadAll(r)
+		assert.NoErr(t, err)
+		assert.NoErr(t, r.Close())
+		assert.Eq(t, len(text), len(rs))
+	}
+}
@@ -0,0 +1,380 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/newacorn/goutils/unsafefn"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// DefaultHandlerMinSize responses shorter than this are sent uncompressed.
+const DefaultHandlerMinSize = 1024
+
+// HandlerOptions configures Handler, the zero value is ready to use.
+type HandlerOptions struct {
+	// Prefer server side preference of codings, nil means DefaultPreferOrders.
+	Prefer []Order
+	// Level passed to Pool for the negotiated coding.
+	// 0 selects every codec's default level.
+	Level int
+	// MinSize responses with fewer bytes are not compressed.
+	// 0 means DefaultHandlerMinSize, negative compress all.
+	MinSize int
+	// MimeOk reports whether a Content-Type is compressible, nil means CheckMimeOk.
+	MimeOk func(mime []byte) bool
+	// Adaptive when set picks the level instead of Level, from the load and the
+	// Content-Length, or the body size when the whole body fits in MinSize.
+	Adaptive *AdaptiveLevel
+}
+
+// Handler wraps next with transparent response compression.
+//
+// The coding is negotiated from Accept-Encoding, and the pooled writer of that
+// coding is used. A response is left as is when its Content-Type is not
+// compressible, its body is shorter than MinSize, it already has a
+// Content-Encoding or a Content-Range, or Cache-Control contains no-transform.
+// Vary: Accept-Encoding is always set, Content-Length is dropped when the
+// response gets compressed.
+func Handler(next http.Handler, opts HandlerOptions) http.Handler {
+	if opts.Level == 0 {
+		opts.Level = -1
+	}
+	if opts.MinSize == 0 {
+		opts.MinSize = DefaultHandlerMinSize
+	}
+	if opts.MinSize < 0 {
+		opts.MinSize = 0
+	}
+	if opts.MimeOk == nil {
+		opts.MimeOk = CheckMimeOk
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		addVary(rw.Header())
+		p, encoding, _ := Negotiate(unsafefn.S2B(r.Header.Get("Accept-Encoding")), opts.Prefer, opts.Level)
+		if p == nil {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		cw := responseWriterPool.Get().(*responseWriter)
+		cw.ResponseWriter = rw
+		cw.opts = &opts
+		cw.pool = p
+		cw.order = Order(encoding)
+		cw.encoding = encoding
+		defer cw.release()
+		next.ServeHTTP(cw, r)
+		cw.finish()
+	})
+}
+
+func addVary(h http.Header) {
+	for _, v := range h.Values("Vary") {
+		if headerHasToken(v, "accept-encoding") {
+			return
+		}
+	}
+	h.Add("Vary", "Accept-Encoding")
+}
+
+// headerHasToken reports whether the comma separated header value v holds token,
+// token must be lower case.
+func headerHasToken(v string, token string) bool {
+	b := unsafefn.S2B(v)
+	for len(b) > 0 {
+		var elem []byte
+		i := bytes.IndexByte(b, ',')
+		if i < 0 {
+			elem, b = b, nil
+		} else {
+			elem, b = b[:i], b[i+1:]
+		}
+		if equalFoldASCII(trimOWS(elem), token) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	stateUndecided uint8 = iota
+	stateIdentity
+	stateCompress
+	stateHijacked
+)
+
+var responseWriterPool = sync.Pool{New: func() any {
+	return &responseWriter{}
+}}
+
+type responseWriter struct {
+	http.ResponseWriter
+	opts     *HandlerOptions
+	pool     Pooler
+	order    Order
+	encoding string
+	w        Writer
+	bw       *bufio.Writer
+	buf      *bpool.Bytes
+	out      countWriter
+	in       int64
+	code     int
+	state    uint8
+	// closed the compressed stream was completed, only then w goes back to
+	// the pool. A panic or a hijack skips it.
+	closed bool
+}
+
+var (
+	_ http.Flusher  = (*responseWriter)(nil)
+	_ http.Hijacker = (*responseWriter)(nil)
+	_ io.ReaderFrom = (*responseWriter)(nil)
+)
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.state != stateUndecided || w.code != 0 {
+		if w.state == stateIdentity || w.state == stateCompress {
+			w.ResponseWriter.WriteHeader(code)
+		}
+		return
+	}
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		// informational responses are sent as they come.
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+	if !bodyAllowed(code) {
+		w.start(true)
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	switch w.state {
+	case stateCompress:
+		n, err := w.w.Write(p)
+		w.in += int64(n)
+		return n, err
+	case stateIdentity:
+		return w.ResponseWriter.Write(p)
+	case stateHijacked:
+		return 0, http.ErrHijacked
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.buf == nil {
+		w.buf = bpool.Get(w.opts.MinSize + len(p))
+	}
+	_, _ = w.buf.Write(p)
+	if w.buf.Len() >= w.opts.MinSize {
+		if err := w.start(false); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// ReadFrom copies r into the response, an identity response is handed to the
+// underlying io.ReaderFrom so that sendfile stays available.
+func (w *responseWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	if w.state == stateUndecided {
+		pb := bpool.Get(bpool.Block4k)
+		buf := pb.B[:bpool.Block4k]
+		for w.state == stateUndecided {
+			var m int
+			m, err = r.Read(buf)
+			if m > 0 {
+				_, ew := w.Write(buf[:m])
+				n += int64(m)
+				if ew != nil {
+					bpool.Put(pb)
+					return n, ew
+				}
+			}
+			if err != nil {
+				bpool.Put(pb)
+				if err == io.EOF {
+					err = nil
+				}
+				return
+			}
+		}
+		bpool.Put(pb)
+	}
+	var m int64
+	switch w.state {
+	case stateIdentity:
+		if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+			m, err = rf.ReadFrom(r)
+		} else {
+			m, err = bpool.Copy(w.ResponseWriter, r)
+		}
+	case stateCompress:
+		m, err = bpool.Copy(w.w, r)
+		w.in += m
+	default:
+		err = http.ErrHijacked
+	}
+	n += m
+	return
+}
+
+// Flush sends out everything written so far. A pending response is started
+// right away, whatever its size.
+func (w *responseWriter) Flush() {
+	switch w.state {
+	case stateUndecided:
+		if w.start(false) != nil {
+			return
+		}
+		if w.state == stateCompress {
+			w.flushCompress()
+		}
+	case stateCompress:
+		w.flushCompress()
+	case stateHijacked:
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) flushCompress() {
+	if w.w.Flush() != nil {
+		return
+	}
+	if w.bw != nil {
+		_ = w.bw.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.state = stateHijacked
+	}
+	return conn, rw, err
+}
+
+// start decides the coding from headers and what has been buffered, sends the
+// header and the buffered body. final means the handler has returned.
+func (w *responseWriter) start(final bool) (err error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	var body []byte
+	if w.buf != nil {
+		body = w.buf.B
+	}
+	if !w.shouldCompress(body, final) {
+		w.state = stateIdentity
+		w.ResponseWriter.WriteHeader(w.code)
+		if len(body) > 0 {
+			_, err = w.ResponseWriter.Write(body)
+		}
+		return
+	}
+	h := w.Header()
+	if w.opts.Adaptive != nil {
+		size := int64(-1)
+		if cl, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+			size = cl
+		} else if final {
+			size = int64(len(body))
+		}
+		w.pool = Pool(w.opts.Adaptive.Level(w.order, size), w.order)
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", w.encoding)
+	w.state = stateCompress
+	w.ResponseWriter.WriteHeader(w.code)
+	w.w = w.pool.Get()
+	w.out.w = w.ResponseWriter
+	if w.pool.NeedBuffer() {
+		w.bw = bpool.GetBw(bpool.Block4k)
+		w.bw.Reset(&w.out)
+		w.w.Reset(w.bw)
+	} else {
+		w.w.Reset(&w.out)
+	}
+	if len(body) > 0 {
+		var n int
+		n, err = w.w.Write(body)
+		w.in += int64(n)
+	}
+	return
+}
+
+func (w *responseWriter) shouldCompress(body []byte, final bool) bool {
+	if !bodyAllowed(w.code) || w.code == http.StatusPartialContent {
+		return false
+	}
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	for _, v := range h.Values("Cache-Control") {
+		if headerHasToken(v, "no-transform") {
+			return false
+		}
+	}
+	if final && (len(body) == 0 || len(body) < w.opts.MinSize) {
+		return false
+	}
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		if len(body) == 0 {
+			return false
+		}
+		// set it now, or net/http would sniff the compressed bytes.
+		ct = http.DetectContentType(body)
+		h.Set("Content-Type", ct)
+	}
+	return w.opts.MimeOk(unsafefn.S2B(ct))
+}
+
+// finish completes the response after the wrapped handler returned.
+func (w *responseWriter) finish() {
+	if w.state == stateUndecided {
+		_ = w.start(true)
+	}
+	if w.state == stateCompress {
+		w.closed = w.w.Close() == nil
+		if w.bw != nil {
+			_ = w.bw.Flush()
+		}
+		RecordBytes(w.pool, w.in, w.out.n)
+	}
+}
+
+func (w *responseWriter) release() {
+	if w.w != nil {
+		putWriter(w.pool, w.w, w.closed)
+	}
+	if w.bw != nil {
+		bpool.PutBw(w.bw)
+	}
+	if w.buf != nil {
+		bpool.Put(w.buf)
+	}
+	*w = responseWriter{}
+	responseWriterPool.Put(w)
+}
+
+func bodyAllowed(code int) bool {
+	return code >= 200 && code != http.StatusNoContent && code != http.StatusNotModified
+}
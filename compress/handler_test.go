@@ -0,0 +1,187 @@
+package compress
+
+import (
+	"bytes"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func serveCompressed(h http.Handler, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerCompress(t *testing.T) {
+	body := strings.Repeat("<p>hello world</p>", 200)
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = io.WriteString(w, body[:100])
+		_, _ = io.WriteString(w, body[100:])
+	}), HandlerOptions{})
+	//
+	rec := serveCompressed(h, "gzip")
+	assert.Eq(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Eq(t, "Accept-Encoding", rec.Header().Get("Vary"))
+	assert.Eq(t, "", rec.Header().Get("Content-Length"))
+	gr, err := gzip.NewReader(rec.Body)
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(gr)
+	assert.NoErr(t, err)
+	assert.Eq(t, body, string(rs))
+	//
+	rec = serveCompressed(h, "zstd")
+	assert.Eq(t, "zstd", rec.Header().Get("Content-Encoding"))
+	zr, err := zstd.NewReader(rec.Body)
+	assert.NoErr(t, err)
+	rs, err = io.ReadAll(zr)
+	assert.NoErr(t, err)
+	assert.Eq(t, body, string(rs))
+	zr.Close()
+	//
+	rec = serveCompressed(h, "br, gzip")
+	assert.Eq(t, "br", rec.Header().Get("Content-Encoding"))
+	br, err := NewReader(Br, rec.Body)
+	assert.NoErr(t, err)
+	rs, err = io.ReadAll(br)
+	assert.NoErr(t, err)
+	assert.Eq(t, body, string(rs))
+	assert.NoErr(t, br.Close())
+	//
+	rec = serveCompressed(h, "")
+	assert.Eq(t, "", rec.Header().Get("Content-Encoding"))
+	assert.Eq(t, "Accept-Encoding", rec.Header().Get("Vary"))
+	assert.Eq(t, strconv.Itoa(len(body)), rec.Header().Get("Content-Length"))
+	assert.Eq(t, body, rec.Body.String())
+}
+
+func TestHandlerSkip(t *testing.T) {
+	body := strings.Repeat("a", 4096)
+	cases := map[string]func(w http.ResponseWriter){
+		"small": func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = io.WriteString(w, "short")
+		},
+		"mime": func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, body)
+		},
+		"encoded": func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "custom")
+			_, _ = io.WriteString(w, body)
+		},
+		"no-transform": func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Cache-Control", "public, No-Transform")
+			_, _ = io.WriteString(w, body)
+		},
+		"not-modified": func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusNotModified)
+		},
+	}
+	for name, fn := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fn(w)
+			}), HandlerOptions{})
+			rec := serveCompressed(h, "gzip, br")
+			assert.NotEq(t, "gzip", rec.Header().Get("Content-Encoding"))
+			assert.NotEq(t, "br", rec.Header().Get("Content-Encoding"))
+			if name == "small" {
+				assert.Eq(t, "short", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerMinSizeNegative(t *testing.T) {
+	body := ""
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, body)
+	}), HandlerOptions{MinSize: -1})
+	// an empty body is never compressed.
+	rec := serveCompressed(h, "gzip")
+	assert.Eq(t, "", rec.Header().Get("Content-Encoding"))
+	assert.Eq(t, 0, rec.Body.Len())
+	// a body short of any MinSize is completed when the handler returns.
+	body = "{}"
+	rec = serveCompressed(h, "gzip")
+	assert.Eq(t, "gzip", rec.Header().Get("Content-Encoding"))
+	gr, err := gzip.NewReader(rec.Body)
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(gr)
+	assert.NoErr(t, err)
+	assert.Eq(t, body, string(rs))
+}
+
+func TestHandlerSniffFlushReadFrom(t *testing.T) {
+	body := strings.Repeat("plain text line\n", 300)
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "first")
+		w.(http.Flusher).Flush()
+		_, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader(body))
+		assert.NoErr(t, err)
+	}), HandlerOptions{})
+	rec := serveCompressed(h, "gzip")
+	assert.True(t, rec.Flushed)
+	assert.Eq(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Eq(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	gr, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(gr)
+	assert.NoErr(t, err)
+	assert.Eq(t, "first"+body, string(rs))
+}
+
+func TestHandlerHijackNotSupported(t *testing.T) {
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := w.(http.Hijacker).Hijack()
+		assert.ErrIs(t, err, http.ErrNotSupported)
+	}), HandlerOptions{})
+	serveCompressed(h, "gzip")
+}
+
+func TestHandlerPanicDropsWriter(t *testing.T) {
+	body := strings.Repeat("<p>panic then serve</p>", 400)
+	abort := true
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, body)
+		if abort {
+			panic(http.ErrAbortHandler)
+		}
+	}), HandlerOptions{})
+	func() {
+		defer func() {
+			assert.Eq(t, http.ErrAbortHandler, recover())
+		}()
+		serveCompressed(h, "br")
+	}()
+	// the unfinished stream of the aborted response does not leak in.
+	abort = false
+	for i := 0; i < 3; i++ {
+		rec := serveCompressed(h, "br")
+		assert.Eq(t, "br", rec.Header().Get("Content-Encoding"))
+		br, err := NewReader(Br, rec.Body)
+		assert.NoErr(t, err)
+		rs, err := io.ReadAll(br)
+		assert.NoErr(t, err)
+		assert.Eq(t, body, string(rs))
+		assert.NoErr(t, br.Close())
+	}
+}
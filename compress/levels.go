@@ -0,0 +1,176 @@
+package compress
+
+import (
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidLevel the text is neither a named level nor an integer.
+var ErrInvalidLevel = errors.New("compress: invalid level")
+
+// PortableLevel codec independent compression level. The named levels map
+// onto each codec with Native, NativeLevel wraps a codec specific value. The
+// zero value is LevelDefault.
+type PortableLevel int
+
+const (
+	// LevelDefault the default level of the codec's pools.
+	LevelDefault PortableLevel = iota
+	LevelFastest
+	LevelFast
+	LevelBetter
+	LevelBest
+)
+
+// nativeBase NativeLevel values start here, far from the named levels.
+const nativeBase = 1 << 10
+
+// levelNames indexed by the named levels.
+var levelNames = [...]string{"default", "fastest", "fast", "better", "best"}
+
+// nativeLevels the value of each named level, after LevelDefault, by Order.
+var nativeLevels = map[Order][4]int{
+	Gzip:    {GzipBestSpeed, 3, 7, GzipBestCompression},
+	Deflate: {DeflateBestSpeed, 3, 7, DeflateBestCompression},
+	Zstd:    {int(zstd.SpeedFastest), int(zstd.SpeedFastest), int(zstd.SpeedBetterCompression), int(zstd.SpeedBestCompression)},
+	Br:      {int(BrotliBestSpeed), 2, int(BrotliHighCompression), int(BrotliBestCompression)},
+	Snappy:  {int(S2SpeedFastest), int(S2SpeedFastest), int(S2SpeedBetterCompression), int(S2SpeedBestCompression)},
+	S2:      {int(S2SpeedFastest), int(S2SpeedFastest), int(S2SpeedBetterCompression), int(S2SpeedBestCompression)},
+}
+
+// NativeLevel a level passed to Pool unchanged, whatever the Order.
+func NativeLevel(level int) PortableLevel {
+	return PortableLevel(nativeBase + level)
+}
+
+// IsNative reports whether l was made by NativeLevel.
+func (l PortableLevel) IsNative() bool {
+	return l > LevelBest
+}
+
+// Native the level of order's pools l stands for. LevelDefault and the Orders
+// without pools give -1, the pool default.
+func (l PortableLevel) Native(order Order) int {
+	if l.IsNative() {
+		return int(l - nativeBase)
+	}
+	levels, ok := nativeLevels[order]
+	if !ok || l <= LevelDefault {
+		return -1
+	}
+	return levels[l-1]
+}
+
+// Pool of order at level l.
+func (l PortableLevel) Pool(order Order) Pooler {
+	return Pool(l.Native(order), order)
+}
+
+func (l PortableLevel) String() string {
+	if l.IsNative() {
+		return strconv.Itoa(int(l - nativeBase))
+	}
+	if l < 0 {
+		return "PortableLevel(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParsePortableLevel a named level, case-insensitive, or an integer native
+// level.
+func ParsePortableLevel(s string) (PortableLevel, error) {
+	s = strings.TrimSpace(s)
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return PortableLevel(i), nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < -nativeBase/2 || n > nativeBase/2 {
+		return 0, ErrInvalidLevel
+	}
+	return NativeLevel(n), nil
+}
+
+func (l PortableLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText see ParsePortableLevel, it makes PortableLevel loadable from
+// JSON, YAML or TOML config.
+func (l *PortableLevel) UnmarshalText(b []byte) (err error) {
+	*l, err = ParsePortableLevel(string(b))
+	return
+}
+
+// UnmarshalJSON accepts numbers besides the level names.
+func (l *PortableLevel) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		s, err := strconv.Unquote(string(b))
+		if err != nil {
+			return ErrInvalidLevel
+		}
+		b = []byte(s)
+	}
+	return l.UnmarshalText(b)
+}
+
+// LevelPreset the level of every codec, tuned once:
+//
+//	{"default": "fast", "orders": {"br": "better", "gzip": 6}}
+//
+// JSON numbers are accepted as native levels. The zero value uses the pools
+// default levels.
+type LevelPreset struct {
+	Default PortableLevel `json:"default"`
+	// Orders overrides Default for some codecs.
+	Orders map[Order]PortableLevel `json:"orders,omitempty"`
+}
+
+// ParseLevelPreset a comma separated preset, the default level first and
+// then order=level overrides:
+//
+//	fast,br=better,gzip=6
+func ParseLevelPreset(s string) (p LevelPreset, err error) {
+	for i, elem := range strings.Split(s, ",") {
+		order, level, found := strings.Cut(elem, "=")
+		if !found {
+			if i != 0 {
+				return LevelPreset{}, ErrInvalidLevel
+			}
+			if p.Default, err = ParsePortableLevel(elem); err != nil {
+				return LevelPreset{}, err
+			}
+			continue
+		}
+		l, err := ParsePortableLevel(level)
+		if err != nil {
+			return LevelPreset{}, err
+		}
+		if p.Orders == nil {
+			p.Orders = make(map[Order]PortableLevel)
+		}
+		p.Orders[Order(strings.ToLower(strings.TrimSpace(order)))] = l
+	}
+	return
+}
+
+// Level the PortableLevel of order.
+func (p LevelPreset) Level(order Order) PortableLevel {
+	if l, ok := p.Orders[order]; ok {
+		return l
+	}
+	return p.Default
+}
+
+// Native the level of order's pools.
+func (p LevelPreset) Native(order Order) int {
+	return p.Level(order).Native(order)
+}
+
+// Pool of order at the preset's level.
+func (p LevelPreset) Pool(order Order) Pooler {
+	return p.Level(order).Pool(order)
+}
@@ -0,0 +1,59 @@
+package compress
+
+import (
+	"encoding/json"
+	"github.com/gookit/goutil/testutil/assert"
+	"testing"
+)
+
+func TestPortableLevel(t *testing.T) {
+	assert.Eq(t, -1, LevelDefault.Native(Gzip))
+	assert.Eq(t, -1, LevelDefault.Native(Br))
+	assert.Eq(t, 1, LevelFastest.Native(Gzip))
+	assert.Eq(t, 9, LevelBest.Native(Deflate))
+	assert.Eq(t, 4, LevelBest.Native(Zstd))
+	assert.Eq(t, 11, LevelBest.Native(Br))
+	assert.Eq(t, -1, LevelBest.Native(Dump))
+	assert.Eq(t, 5, NativeLevel(5).Native(Br))
+	assert.Eq(t, -2, NativeLevel(-2).Native(Deflate))
+	assert.Eq(t, Pool(11, Br), LevelBest.Pool(Br))
+	//
+	for _, s := range []string{"default", "fastest", "fast", "better", "best", "0", "-2", "11"} {
+		l, err := ParsePortableLevel(s)
+		assert.NoErr(t, err)
+		assert.Eq(t, s, l.String())
+	}
+	l, err := ParsePortableLevel(" Best ")
+	assert.NoErr(t, err)
+	assert.Eq(t, LevelBest, l)
+	_, err = ParsePortableLevel("quick")
+	assert.ErrIs(t, err, ErrInvalidLevel)
+	_, err = ParsePortableLevel("100000")
+	assert.ErrIs(t, err, ErrInvalidLevel)
+}
+
+func TestLevelPreset(t *testing.T) {
+	var p LevelPreset
+	assert.NoErr(t, json.Unmarshal([]byte(`{"default":"fast","orders":{"br":"better","gzip":6}}`), &p))
+	assert.Eq(t, LevelFast, p.Default)
+	assert.Eq(t, 6, p.Native(Gzip))
+	assert.Eq(t, 6, p.Native(Br))
+	assert.Eq(t, 3, p.Native(Deflate))
+	assert.Eq(t, DefaultZstdCompressPools.Pool(1), p.Pool(Zstd))
+	//
+	b, err := json.Marshal(p)
+	assert.NoErr(t, err)
+	var p2 LevelPreset
+	assert.NoErr(t, json.Unmarshal(b, &p2))
+	assert.Eq(t, p, p2)
+	//
+	p3, err := ParseLevelPreset("fast, br=better ,GZIP=6")
+	assert.NoErr(t, err)
+	assert.Eq(t, p, p3)
+	_, err = ParseLevelPreset("fast,best")
+	assert.ErrIs(t, err, ErrInvalidLevel)
+	assert.Err(t, json.Unmarshal([]byte(`{"default":"slow"}`), &p))
+	//
+	var zero LevelPreset
+	assert.Eq(t, -1, zero.Native(Zstd))
+}
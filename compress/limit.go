@@ -0,0 +1,97 @@
+package compress
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// ErrDecompressedTooLarge decoded output went past Limits.MaxSize.
+	ErrDecompressedTooLarge = errors.New("compress: decompressed size exceeds limit")
+	// ErrExpansionTooLarge decoded output grew past Limits.MaxRatio times the input.
+	ErrExpansionTooLarge = errors.New("compress: expansion ratio exceeds limit")
+)
+
+// DefaultRatioMinSize output size from which Limits.MaxRatio is enforced when
+// RatioMinSize is unset. A few bytes legitimately expand a lot.
+const DefaultRatioMinSize = 64 << 10
+
+// Limits bounds what a decoder may produce, zero fields are not enforced.
+type Limits struct {
+	// MaxSize maximum decompressed bytes.
+	MaxSize int64
+	// MaxRatio maximum decompressed bytes per compressed byte read.
+	MaxRatio float64
+	// RatioMinSize MaxRatio is checked once the output reaches this size,
+	// 0 means DefaultRatioMinSize.
+	RatioMinSize int64
+}
+
+// NewLimitedReader is NewReader whose output is checked against limits. When
+// a limit is exceeded Read returns ErrDecompressedTooLarge or
+// ErrExpansionTooLarge, and keeps returning it. At most MaxSize bytes are
+// delivered.
+func NewLimitedReader(order Order, src io.Reader, limits Limits) (io.ReadCloser, error) {
+	lr := &limitedReader{limits: limits, src: countingReader{r: src}}
+	if lr.limits.RatioMinSize == 0 {
+		lr.limits.RatioMinSize = DefaultRatioMinSize
+	}
+	rc, err := NewReader(order, &lr.src)
+	if err != nil {
+		return nil, err
+	}
+	lr.rc = rc
+	return lr, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += int64(n)
+	return
+}
+
+type limitedReader struct {
+	rc     io.ReadCloser
+	src    countingReader
+	limits Limits
+	out    int64
+	err    error
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if max := l.limits.MaxSize; max > 0 {
+		if l.out >= max {
+			// anything left past the limit is an error.
+			var one [1]byte
+			n, err = l.rc.Read(one[:])
+			if n > 0 {
+				l.err = ErrDecompressedTooLarge
+				return 0, l.err
+			}
+			return 0, err
+		}
+		if remain := max - l.out; int64(len(p)) > remain {
+			p = p[:remain]
+		}
+	}
+	n, err = l.rc.Read(p)
+	l.out += int64(n)
+	if l.limits.MaxRatio > 0 && l.out >= l.limits.RatioMinSize && l.src.n > 0 &&
+		float64(l.out) > l.limits.MaxRatio*float64(l.src.n) {
+		l.err = ErrExpansionTooLarge
+		return n, l.err
+	}
+	return
+}
+
+func (l *limitedReader) Close() error {
+	return l.rc.Close()
+}
@@ -0,0 +1,46 @@
+package compress
+
+import (
+	"errors"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/goutils/bytes"
+	"github.com/xyproto/randomstring"
+	"io"
+	"testing"
+)
+
+func TestNewLimitedReaderBomb(t *testing.T) {
+	zeros := make([]byte, 8<<20)
+	for _, order := range []Order{Gzip, Deflate, Zstd, Br} {
+		t.Run(string(order), func(t *testing.T) {
+			compressed := compressForTest(t, order, 5, zeros)
+			//
+			r, err := NewLimitedReader(order, bytes.NewBuffer(compressed), Limits{MaxSize: 1 << 20})
+			assert.NoErr(t, err)
+			rs, err := io.ReadAll(r)
+			assert.True(t, errors.Is(err, ErrDecompressedTooLarge))
+			assert.Eq(t, 1<<20, len(rs))
+			assert.NoErr(t, r.Close())
+			//
+			r, err = NewLimitedReader(order, bytes.NewBuffer(compressed), Limits{MaxRatio: 100})
+			assert.NoErr(t, err)
+			_, err = io.ReadAll(r)
+			assert.True(t, errors.Is(err, ErrExpansionTooLarge))
+			// sticky
+			_, err = r.Read(make([]byte, 10))
+			assert.True(t, errors.Is(err, ErrExpansionTooLarge))
+			assert.NoErr(t, r.Close())
+		})
+	}
+}
+
+func TestNewLimitedReaderWithinLimits(t *testing.T) {
+	dataBytes := []byte(randomstring.HumanFriendlyString(1 << 16))
+	compressed := compressForTest(t, Gzip, -1, dataBytes)
+	r, err := NewLimitedReader(Gzip, bytes.NewBuffer(compressed), Limits{MaxSize: int64(len(dataBytes)), MaxRatio: 50})
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, dataBytes, rs)
+	assert.NoErr(t, r.Close())
+}
@@ -0,0 +1,105 @@
+package compress
+
+import (
+	"bytes"
+	"strings"
+)
+
+// maxMimeLen longer media types never match, a type and a subtype are at most
+// 127 characters each (RFC 6838 section 4.2).
+const maxMimeLen = 255
+
+// MimeMatcher set of compressible media types, built from exact types
+// ("text/html"), wildcards ("text/*") and structured syntax suffixes
+// ("+json"). Parameters and case are ignored and Match does not allocate.
+//
+// Build it before sharing, Add is not safe for use concurrent with Match.
+type MimeMatcher struct {
+	exact    map[string]struct{}
+	types    map[string]struct{}
+	suffixes map[string]struct{}
+}
+
+// DefaultMimeMatcher the types of CheckMimeOk, plus text/javascript,
+// application/wasm, application/manifest+json and the +json and +xml ones.
+var DefaultMimeMatcher = NewMimeMatcher(
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"application/wasm",
+	"application/manifest+json",
+	"image/svg+xml",
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/xml",
+	"text/csv",
+	"text/yaml",
+	"text/markdown",
+	"text/javascript",
+	"+json",
+	"+xml",
+)
+
+// NewMimeMatcher calls Add for each pattern.
+func NewMimeMatcher(patterns ...string) *MimeMatcher {
+	m := &MimeMatcher{
+		exact:    make(map[string]struct{}),
+		types:    make(map[string]struct{}),
+		suffixes: make(map[string]struct{}),
+	}
+	for _, p := range patterns {
+		m.Add(p)
+	}
+	return m
+}
+
+// Add pattern, one of "type/subtype", "type/*" or "+suffix".
+func (m *MimeMatcher) Add(pattern string) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	switch {
+	case strings.HasPrefix(pattern, "+"):
+		m.suffixes[pattern[1:]] = struct{}{}
+	case strings.HasSuffix(pattern, "/*"):
+		m.types[pattern[:len(pattern)-2]] = struct{}{}
+	default:
+		m.exact[pattern] = struct{}{}
+	}
+}
+
+// Match reports whether the Content-Type value mime is in the set, it has the
+// signature of HandlerOptions.MimeOk.
+func (m *MimeMatcher) Match(mime []byte) bool {
+	if i := bytes.IndexByte(mime, ';'); i >= 0 {
+		mime = mime[:i]
+	}
+	mime = trimOWS(mime)
+	if len(mime) > maxMimeLen {
+		return false
+	}
+	var buf [maxMimeLen]byte
+	slash := -1
+	for i, c := range mime {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		} else if c == '/' && slash < 0 {
+			slash = i
+		}
+		buf[i] = c
+	}
+	if slash <= 0 || slash == len(mime)-1 {
+		return false
+	}
+	lower := buf[:len(mime)]
+	if _, ok := m.exact[string(lower)]; ok {
+		return true
+	}
+	if _, ok := m.types[string(lower[:slash])]; ok {
+		return true
+	}
+	if i := bytes.LastIndexByte(lower[slash:], '+'); i >= 0 {
+		_, ok := m.suffixes[string(lower[slash+i+1:])]
+		return ok
+	}
+	return false
+}
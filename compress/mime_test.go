@@ -0,0 +1,52 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"testing"
+)
+
+func TestMimeMatcher(t *testing.T) {
+	m := NewMimeMatcher("text/*", "application/json", "+xml", "Image/SVG+XML")
+	for mime, ok := range map[string]bool{
+		"text/html":                         true,
+		"TEXT/Plain; charset=utf-8":         true,
+		"application/json":                  true,
+		"application/json ; charset=utf-8":  true,
+		"application/atom+xml":              true,
+		"image/svg+xml":                     true,
+		"application/problem+json":          false,
+		"application/jsonx":                 false,
+		"application/octet-stream":          false,
+		"text":                              false,
+		"text/":                             false,
+		"/html":                             false,
+		"":                                  false,
+		"image/png":                         false,
+		"application/vnd.api+json+zip":      false,
+		"application/vnd.example+xml;q=abc": true,
+	} {
+		assert.Eq(t, ok, m.Match([]byte(mime)), mime)
+	}
+	//
+	for _, mime := range []string{"text/javascript", "application/wasm", "application/manifest+json", "application/ld+json", "application/rss+xml"} {
+		assert.True(t, DefaultMimeMatcher.Match([]byte(mime)), mime)
+	}
+	assert.False(t, DefaultMimeMatcher.Match([]byte("image/jpeg")))
+	// CheckMimeOk is left as it was.
+	for _, mime := range []string{"text/javascript", "application/wasm", "application/manifest+json", "text/java", "application/wasmx"} {
+		assert.False(t, CheckMimeOk([]byte(mime)), mime)
+	}
+	//
+	mime := []byte("Application/Vnd.Api+JSON; charset=utf-8")
+	allocs := testing.AllocsPerRun(100, func() {
+		DefaultMimeMatcher.Match(mime)
+	})
+	assert.Eq(t, 0.0, allocs)
+}
+
+func BenchmarkMimeMatcher(b *testing.B) {
+	mime := []byte("application/json; charset=utf-8")
+	for i := 0; i < b.N; i++ {
+		DefaultMimeMatcher.Match(mime)
+	}
+}
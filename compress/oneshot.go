@@ -0,0 +1,153 @@
+package compress
+
+import (
+	"bytes"
+	"github.com/klauspost/compress/zstd"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io"
+	"sync"
+)
+
+// AppendCompressed appends the order coding of src to dst, with a pooled
+// writer of level. Zstd uses the encoder's EncodeAll.
+func AppendCompressed(dst, src []byte, order Order, level int) ([]byte, error) {
+	p := Pool(level, order)
+	if p == nil {
+		return dst, ErrUnsupportedOrder
+	}
+	w := p.Get()
+	n := len(dst)
+	if enc, ok := w.(*zstd.Encoder); ok {
+		dst = enc.EncodeAll(src, dst)
+		p.Put(w)
+		RecordBytes(p, int64(len(src)), int64(len(dst)-n))
+		return dst, nil
+	}
+	sw := sliceWriterPool.Get().(*sliceWriter)
+	sw.b = dst
+	w.Reset(sw)
+	_, err := w.Write(src)
+	if err == nil {
+		err = w.Close()
+	}
+	putWriter(p, w, err == nil)
+	dst = sw.b
+	sw.b = nil
+	sliceWriterPool.Put(sw)
+	if err != nil {
+		return dst[:n], err
+	}
+	RecordBytes(p, int64(len(src)), int64(len(dst)-n))
+	return dst, nil
+}
+
+// AppendDecompressed appends the decoding of the order coded src to dst.
+// maxSize > 0 bounds the decoded size, ErrDecompressedTooLarge is returned
+// past it. Zstd uses the decoder's DecodeAll when maxSize is not set.
+func AppendDecompressed(dst, src []byte, order Order, maxSize int) ([]byte, error) {
+	n := len(dst)
+	switch order {
+	case Identity:
+		if maxSize > 0 && len(src) > maxSize {
+			return dst, ErrDecompressedTooLarge
+		}
+		return append(dst, src...), nil
+	case Zstd:
+		if maxSize <= 0 {
+			zr := DefaultZstdReaderPool.Get()
+			// a stream given back unfinished still holds the block decoder
+			// DecodeAll waits for.
+			_ = zr.Reset(nil)
+			dst, err := zr.DecodeAll(src, dst)
+			DefaultZstdReaderPool.Put(zr)
+			if err != nil {
+				return dst[:n], err
+			}
+			return dst, nil
+		}
+	}
+	br := bytesReaderPool.Get().(*bytes.Reader)
+	defer bytesReaderPool.Put(br)
+	br.Reset(src)
+	r, err := NewReader(order, br)
+	if err != nil {
+		return dst, err
+	}
+	dst, err = readAppend(dst, r, maxSize)
+	if ec := r.Close(); err == nil {
+		err = ec
+	}
+	br.Reset(nil)
+	if err != nil {
+		return dst[:n], err
+	}
+	return dst, nil
+}
+
+// CompressBytes is AppendCompressed into a pooled buffer, to be given back
+// with bpool.Put.
+func CompressBytes(src []byte, order Order, level int) (*bpool.Bytes, error) {
+	b := bpool.Get(len(src)/2 + 64)
+	var err error
+	b.B, err = AppendCompressed(b.B, src, order, level)
+	if err != nil {
+		bpool.Put(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// DecompressBytes is AppendDecompressed into a pooled buffer, to be given back
+// with bpool.Put.
+func DecompressBytes(src []byte, order Order, maxSize int) (*bpool.Bytes, error) {
+	size := len(src) * 3
+	if maxSize > 0 {
+		size = min(size, maxSize)
+	}
+	b := bpool.Get(size)
+	var err error
+	b.B, err = AppendDecompressed(b.B, src, order, maxSize)
+	if err != nil {
+		bpool.Put(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// readAppend reads r to EOF into dst, at most maxSize bytes when positive.
+func readAppend(dst []byte, r io.Reader, maxSize int) ([]byte, error) {
+	n := len(dst)
+	for {
+		if len(dst) == cap(dst) {
+			dst = append(dst, 0)[:len(dst)]
+		}
+		m, err := r.Read(dst[len(dst):cap(dst)])
+		dst = dst[:len(dst)+m]
+		if maxSize > 0 && len(dst)-n > maxSize {
+			return dst, ErrDecompressedTooLarge
+		}
+		if err == io.EOF {
+			return dst, nil
+		}
+		if err != nil {
+			return dst, err
+		}
+	}
+}
+
+type sliceWriter struct {
+	b []byte
+}
+
+func (s *sliceWriter) Write(p []byte) (int, error) {
+	s.b = append(s.b, p...)
+	return len(p), nil
+}
+
+var sliceWriterPool = sync.Pool{New: func() any {
+	return &sliceWriter{}
+}}
+
+var bytesReaderPool = sync.Pool{New: func() any {
+	return bytes.NewReader(nil)
+}}
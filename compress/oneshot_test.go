@@ -0,0 +1,63 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestAppendCompressed(t *testing.T) {
+	src := []byte(strings.Repeat("queue message payload ", 500))
+	for _, order := range []Order{Gzip, Deflate, Zstd, Br, Identity} {
+		prefix := []byte("head")
+		if order == Identity {
+			_, err := AppendCompressed(prefix, src, order, -1)
+			assert.ErrIs(t, err, ErrUnsupportedOrder)
+			continue
+		}
+		c, err := AppendCompressed(prefix, src, order, -1)
+		assert.NoErr(t, err)
+		assert.Eq(t, "head", string(c[:4]))
+		assert.Lt(t, len(c), len(src)/4)
+		//
+		d, err := AppendDecompressed([]byte("x"), c[4:], order, 0)
+		assert.NoErr(t, err)
+		assert.Eq(t, "x"+string(src), string(d))
+		d, err = AppendDecompressed(nil, c[4:], order, len(src))
+		assert.NoErr(t, err)
+		assert.Eq(t, src, d)
+		d, err = AppendDecompressed([]byte("x"), c[4:], order, len(src)-1)
+		assert.ErrIs(t, err, ErrDecompressedTooLarge)
+		assert.Eq(t, "x", string(d))
+		_, err = AppendDecompressed(nil, c[4:len(c)-4], order, 0)
+		assert.Err(t, err, string(order))
+		if order != Zstd {
+			assert.ErrIs(t, err, io.ErrUnexpectedEOF, string(order))
+		}
+		//
+		b, err := CompressBytes(src, order, -1)
+		assert.NoErr(t, err)
+		assert.Eq(t, c[4:], b.B)
+		db, err := DecompressBytes(b.B, order, 0)
+		assert.NoErr(t, err)
+		assert.Eq(t, src, db.B)
+		bpool.Put(b)
+		bpool.Put(db)
+	}
+	d, err := AppendDecompressed(nil, src, Identity, 0)
+	assert.NoErr(t, err)
+	assert.Eq(t, src, d)
+	_, err = AppendDecompressed(nil, src, Dump, 0)
+	assert.ErrIs(t, err, ErrUnsupportedOrder)
+}
+
+func BenchmarkAppendCompressed(b *testing.B) {
+	src := []byte(strings.Repeat("queue message payload ", 50))
+	dst := make([]byte, 0, 4096)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dst, _ = AppendCompressed(dst[:0], src, Gzip, -1)
+	}
+}
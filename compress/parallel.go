@@ -0,0 +1,194 @@
+package compress
+
+import (
+	"errors"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io"
+	"runtime"
+)
+
+// DefaultParallelBlockSize input bytes compressed by each worker.
+const DefaultParallelBlockSize = 1 << 20
+
+var errParallelClosed = errors.New("compress: write on closed parallel writer")
+
+// ParallelOptions configures NewParallelWriter, the zero value is ready to use.
+type ParallelOptions struct {
+	// Level passed to Pool, 0 selects the codec's default level.
+	Level int
+	// BlockSize input bytes per block, 0 means DefaultParallelBlockSize.
+	BlockSize int
+	// Workers blocks compressed at once, 0 means GOMAXPROCS.
+	Workers int
+}
+
+// ParallelWriter compresses blocks of its input concurrently, each with a
+// writer of the pools. The blocks are written in order as gzip members or zstd
+// frames, which standard decoders read as one stream.
+//
+// zlib and brotli streams can not be concatenated, Deflate and Br are not
+// supported.
+type ParallelWriter struct {
+	dst       io.Writer
+	pool      Pooler
+	blockSize int
+	workers   int
+	cur       *bpool.Bytes
+	// queue blocks in flight, oldest first.
+	queue  []*parallelBlock
+	blocks int
+	err    error
+	closed bool
+}
+
+var _ Writer = (*ParallelWriter)(nil)
+
+type parallelBlock struct {
+	in   *bpool.Bytes
+	out  *bpool.Bytes
+	err  error
+	done chan struct{}
+}
+
+// NewParallelWriter writes the order coding of what is written to it to dst.
+func NewParallelWriter(dst io.Writer, order Order, opts ParallelOptions) (*ParallelWriter, error) {
+	if order != Gzip && order != Zstd {
+		return nil, ErrUnsupportedOrder
+	}
+	if opts.Level == 0 {
+		opts.Level = -1
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = DefaultParallelBlockSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	return &ParallelWriter{
+		dst:       dst,
+		pool:      Pool(opts.Level, order),
+		blockSize: opts.BlockSize,
+		workers:   opts.Workers,
+	}, nil
+}
+
+func (p *ParallelWriter) Write(b []byte) (n int, err error) {
+	if p.closed {
+		return 0, errParallelClosed
+	}
+	if p.err != nil {
+		return 0, p.err
+	}
+	for len(b) > 0 {
+		if p.cur == nil {
+			p.cur = bpool.Get(p.blockSize)
+		}
+		m := min(p.blockSize-p.cur.Len(), len(b))
+		p.cur.B = append(p.cur.B, b[:m]...)
+		b = b[m:]
+		n += m
+		if p.cur.Len() >= p.blockSize {
+			if err = p.submit(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Flush compresses the buffered input as a block of its own and writes every
+// pending block to dst.
+func (p *ParallelWriter) Flush() error {
+	if p.closed {
+		return errParallelClosed
+	}
+	if p.cur != nil && p.cur.Len() > 0 {
+		if err := p.submit(); err != nil {
+			return err
+		}
+	}
+	return p.drain(0)
+}
+
+// Close flushes, it does not close dst. An empty input still gets one empty
+// member or frame so that the output is valid.
+func (p *ParallelWriter) Close() error {
+	if p.closed {
+		return errParallelClosed
+	}
+	if p.err == nil && ((p.cur != nil && p.cur.Len() > 0) || p.blocks == 0) {
+		if p.cur == nil {
+			p.cur = bpool.Get(0)
+		}
+		_ = p.submit()
+	}
+	err := p.drain(0)
+	if p.cur != nil {
+		bpool.Put(p.cur)
+		p.cur = nil
+	}
+	p.closed = true
+	return err
+}
+
+// Reset discards the state, p then writes to dst.
+func (p *ParallelWriter) Reset(dst io.Writer) {
+	p.err = errParallelClosed
+	_ = p.drain(0)
+	if p.cur != nil {
+		bpool.Put(p.cur)
+		p.cur = nil
+	}
+	p.dst = dst
+	p.blocks = 0
+	p.err = nil
+	p.closed = false
+}
+
+// submit starts compressing cur, waiting for the oldest block when all the
+// workers are busy.
+func (p *ParallelWriter) submit() error {
+	if err := p.drain(p.workers - 1); err != nil {
+		return err
+	}
+	blk := &parallelBlock{in: p.cur, done: make(chan struct{})}
+	p.cur = nil
+	p.queue = append(p.queue, blk)
+	p.blocks++
+	go blk.compress(p.pool)
+	return nil
+}
+
+// drain writes the oldest blocks to dst until at most n are in flight.
+func (p *ParallelWriter) drain(n int) error {
+	for len(p.queue) > n {
+		blk := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		<-blk.done
+		if p.err == nil {
+			if blk.err != nil {
+				p.err = blk.err
+			} else if _, err := p.dst.Write(blk.out.B); err != nil {
+				p.err = err
+			}
+		}
+		bpool.Put(blk.out)
+	}
+	return p.err
+}
+
+func (b *parallelBlock) compress(pool Pooler) {
+	b.out = bpool.Get(b.in.Len()/2 + 64)
+	w := pool.Get()
+	w.Reset(b.out)
+	_, b.err = w.Write(b.in.B)
+	if err := w.Close(); b.err == nil {
+		b.err = err
+	}
+	putWriter(pool, w, b.err == nil)
+	RecordBytes(pool, int64(b.in.Len()), int64(b.out.Len()))
+	bpool.Put(b.in)
+	b.in = nil
+	close(b.done)
+}
@@ -0,0 +1,63 @@
+package compress
+
+import (
+	"fmt"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/newacorn/goutils/bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParallelWriter(t *testing.T) {
+	sb := strings.Builder{}
+	for i := 0; sb.Len() < 300<<10; i++ {
+		_, _ = fmt.Fprintf(&sb, "line %d of the export,", i)
+	}
+	src := sb.String()
+	for _, order := range []Order{Gzip, Zstd} {
+		buf := bytes.Buffer{}
+		w, err := NewParallelWriter(&buf, order, ParallelOptions{BlockSize: 16 << 10, Workers: 4})
+		assert.NoErr(t, err)
+		for i := 0; i < len(src); i += 7000 {
+			_, err = w.Write([]byte(src[i:min(i+7000, len(src))]))
+			assert.NoErr(t, err)
+			if i == 70000 {
+				assert.NoErr(t, w.Flush())
+			}
+		}
+		assert.NoErr(t, w.Close())
+		_, err = w.Write([]byte("x"))
+		assert.Err(t, err)
+		assert.Lt(t, buf.Len(), len(src)/2)
+		//
+		var rs []byte
+		if order == Gzip {
+			gr, err := gzip.NewReader(&buf)
+			assert.NoErr(t, err)
+			rs, err = io.ReadAll(gr)
+			assert.NoErr(t, err)
+		} else {
+			zr, err := zstd.NewReader(&buf)
+			assert.NoErr(t, err)
+			rs, err = io.ReadAll(zr)
+			assert.NoErr(t, err)
+			zr.Close()
+		}
+		assert.Eq(t, src, string(rs))
+		// empty input is still a valid stream.
+		buf.Reset()
+		w.Reset(&buf)
+		assert.NoErr(t, w.Close())
+		r, err := NewReader(order, &buf)
+		assert.NoErr(t, err)
+		rs, err = io.ReadAll(r)
+		assert.NoErr(t, err)
+		assert.Empty(t, rs)
+		assert.NoErr(t, r.Close())
+	}
+	_, err := NewParallelWriter(io.Discard, Br, ParallelOptions{})
+	assert.ErrIs(t, err, ErrUnsupportedOrder)
+}
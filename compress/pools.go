@@ -3,31 +3,20 @@ package compress
 import (
 	"bytes"
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
 	"github.com/klauspost/compress/zlib"
 	"github.com/klauspost/compress/zstd"
 	"github.com/newacorn/brotli"
 	"github.com/newacorn/brotli/matchfinder"
-	"github.com/newacorn/cbrotli/go/cbrotli"
 	"sync/atomic"
 
 	"io"
-	"runtime"
 	"strings"
 	"sync"
 )
 
-//goland:noinspection GoNameStartsWithPackageName
-type CompressInfo struct {
-	level int
-	pw    io.WriteCloser
-	src   io.Reader
-}
-
 var _ Writer = (*matchfinder.Writer)(nil)
 
-//goland:noinspection GoNameStartsWithPackageName
-type CompressInfoChan chan *CompressInfo
-
 var InitCount atomic.Int64
 
 const levelCount = 12
@@ -55,8 +44,13 @@ var DefaultGzipCompressPools = &PoolContainer[*gzip.Writer]{
 var DefaultZstdCompressPools = &PoolContainer[*zstd.Encoder]{
 	defaultLevel: int(zstd.SpeedDefault),
 	offset:       0,
-	poolsInit: func() [12]*CompressPool[*zstd.Encoder] {
-		var pools [12]*CompressPool[*zstd.Encoder]
+	poolsInit:    zstdPoolsInit(),
+}
+
+// zstdPoolsInit opts are applied to every encoder after the level.
+func zstdPoolsInit(opts ...zstd.EOption) func() [levelCount]*CompressPool[*zstd.Encoder] {
+	return func() [levelCount]*CompressPool[*zstd.Encoder] {
+		var pools [levelCount]*CompressPool[*zstd.Encoder]
 		for i := range pools {
 			level := i
 			if level >= 5 {
@@ -67,31 +61,37 @@ var DefaultZstdCompressPools = &PoolContainer[*zstd.Encoder]{
 			}
 			pools[i] = &CompressPool[*zstd.Encoder]{Pool: sync.Pool{
 				New: func() any {
-					w, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevel(level)))
+					w, err := zstd.NewWriter(nil, append([]zstd.EOption{zstd.WithEncoderLevel(zstd.EncoderLevel(level))}, opts...)...)
 					_ = err
 					return w
 				}}}
 		}
 		return pools
-	},
+	}
 }
 
 var DefaultDeflateCompressPools = &PoolContainer[*zlib.Writer]{
 	defaultLevel: zlib.DefaultCompression,
 	offset:       2,
-	poolsInit: func() [12]*CompressPool[*zlib.Writer] {
-		var pools [12]*CompressPool[*zlib.Writer]
+	poolsInit:    deflatePoolsInit(nil),
+}
+
+// deflatePoolsInit writers are built with the preset dictionary dict, nil for none.
+func deflatePoolsInit(dict []byte) func() [levelCount]*CompressPool[*zlib.Writer] {
+	return func() [levelCount]*CompressPool[*zlib.Writer] {
+		var pools [levelCount]*CompressPool[*zlib.Writer]
 		for i := range pools {
 			level := i - 2
 			pools[i] = &CompressPool[*zlib.Writer]{Pool: sync.Pool{
 				New: func() any {
-					w, _ := zlib.NewWriterLevel(nil, level)
+					w, _ := zlib.NewWriterLevelDict(nil, level, dict)
 					return w
 				}}, needBuffer: true}
 		}
 		return pools
-	},
+	}
 }
+
 var DefaultBrotliCompressPools = &PoolContainer[*matchfinder.Writer]{
 	defaultLevel: 4,
 	offset:       0,
@@ -108,27 +108,6 @@ var DefaultBrotliCompressPools = &PoolContainer[*matchfinder.Writer]{
 		return pools
 	},
 }
-var DefaultCBrotliCompressPools = &PoolContainer[*cbrotli.WWriter]{
-	defaultLevel: 3,
-	offset:       0,
-	poolsInit: func() [12]*CompressPool[*cbrotli.WWriter] {
-		var pools [12]*CompressPool[*cbrotli.WWriter]
-		for i := range pools {
-			level := i
-			pools[i] = &CompressPool[*cbrotli.WWriter]{Pool: sync.Pool{
-				New: func() any {
-					w := cbrotli.NewWWriter(nil, cbrotli.WriterV2Options{
-						Quality: level,
-					})
-					runtime.SetFinalizer(w, func(w *cbrotli.WWriter) {
-						w.Destroy()
-					})
-					return w
-				}}}
-		}
-		return pools
-	},
-}
 
 //goland:noinspection GoNameStartsWithPackageName
 type CompressCBrotliPools struct {
@@ -137,21 +116,20 @@ type CompressCBrotliPools struct {
 }
 
 func init() {
-	DefaultZstdCompressPools.pools = DefaultZstdCompressPools.poolsInit()
-	DefaultGzipCompressPools.pools = DefaultGzipCompressPools.poolsInit()
-	DefaultBrotliCompressPools.pools = DefaultBrotliCompressPools.poolsInit()
-	DefaultDeflateCompressPools.pools = DefaultDeflateCompressPools.poolsInit()
-	DefaultCBrotliCompressPools.pools = DefaultCBrotliCompressPools.poolsInit()
-}
-
-type comWriter interface {
-	*gzip.Writer | *zlib.Writer | *matchfinder.Writer | *zstd.Encoder | *cbrotli.WWriter
+	DefaultZstdCompressPools.init()
+	DefaultGzipCompressPools.init()
+	DefaultBrotliCompressPools.init()
+	DefaultDeflateCompressPools.init()
 }
 
 //goland:noinspection GoNameStartsWithPackageName
 type CompressPool[T comWriter] struct {
+	// Pool New creates the writers, Get and Put keep the idle ones in idle.
 	sync.Pool
+	// idle has no New, Drain empties it without creating a writer.
+	idle       sync.Pool
 	needBuffer bool
+	counters   poolCounters
 }
 
 func (c *CompressPool[T]) NeedBuffer() bool {
@@ -160,12 +138,23 @@ func (c *CompressPool[T]) NeedBuffer() bool {
 func (c *CompressPool[T]) Get() Writer {
 	var t T
 	_ = Writer(t)
-	return c.Pool.Get().(Writer)
+	c.counters.gets.Add(1)
+	if w, ok := c.idle.Get().(Writer); ok {
+		return w
+	}
+	return c.create()
+}
+
+// create a writer with New and count it.
+func (c *CompressPool[T]) create() Writer {
+	c.counters.news.Add(1)
+	return c.New().(Writer)
 }
 func (c *CompressPool[T]) Put(compressW Writer) {
 	var t T
 	_ = Writer(t)
-	c.Pool.Put(compressW)
+	c.counters.puts.Add(1)
+	c.idle.Put(compressW)
 }
 
 type PoolContainerInter interface {
@@ -187,6 +176,24 @@ type Pooler interface {
 	NeedBuffer() bool
 }
 
+// putWriter gives w back to p when completed, its stream closed without error,
+// after dropping its destination. An uncompleted writer is destroyed instead:
+// Reset of the cgo brotli writer keeps the encoder state, the next stream
+// would continue this one.
+func putWriter(p Pooler, w Writer, completed bool) {
+	if !completed {
+		destroyWriter(w)
+		return
+	}
+	w.Reset(nil)
+	p.Put(w)
+}
+
+// init builds the pools.
+func (cps *PoolContainer[T]) init() {
+	cps.pools = cps.poolsInit()
+}
+
 func (cps *PoolContainer[T]) Pool(level int) *CompressPool[T] {
 	level = cps.offset + level
 	if level < 0 || level >= levelCount {
@@ -212,32 +219,36 @@ var DefaultGzipReaderPool ReaderPool[*gzip.Reader]
 var DefaultDeflateReaderPool ReaderPool[DeflateReader]
 var DefaultDeflateReaderDictPool = &DefaultDeflateReaderPool.Pool
 var DefaultBrotliReaderPool ReaderPool[*brotli.Reader]
-var DefaultCBrotliReaderPool CBrotliReaderPool
 var DefaultZstdReaderPool ReaderPool[ZstdReader]
 
-type CBrotliReaderPool struct{}
 type DeflateReaderPool struct{ sync.Pool }
 
-func (b CBrotliReaderPool) Get() *cbrotli.ReaderV2 {
-	return cbrotli.NewReaderV2(nil)
-}
-
-func (b CBrotliReaderPool) Put(r *cbrotli.ReaderV2) {
-	_ = r.Close()
-}
-
 type comReader interface {
-	*gzip.Reader | *brotli.Reader | ZstdReader | DeflateReader
+	*gzip.Reader | *brotli.Reader | ZstdReader | DeflateReader | *s2.Reader
 }
 type ReaderPool[T comReader] struct {
+	// Pool New creates the readers, Get and Put keep the idle ones in idle.
 	sync.Pool
+	// idle has no New, Drain empties it without creating a reader.
+	idle sync.Pool
+	// news readers created by Get and Prewarm.
+	news atomic.Int64
 }
 
 func (b *ReaderPool[T]) Get() T {
-	return b.Pool.Get().(T)
+	if r, ok := b.idle.Get().(T); ok {
+		return r
+	}
+	return b.create()
+}
+
+// create a reader with New and count it.
+func (b *ReaderPool[T]) create() T {
+	b.news.Add(1)
+	return b.New().(T)
 }
 func (b *ReaderPool[T]) Put(w T) {
-	b.Pool.Put(w)
+	b.idle.Put(w)
 }
 
 type DeflateReader struct {
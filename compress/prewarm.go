@@ -0,0 +1,81 @@
+package compress
+
+// Pools keep idle writers and readers in a sync.Pool, which drops them after two
+// garbage collections. Prewarm spares the first requests after start-up the
+// construction of the encoders, it does not keep them warm for good.
+//
+// Drain is best-effort: a sync.Pool keeps one value per P that only a Get on
+// that P returns, Drain misses those of the other Ps. The cgo brotli writers
+// it misses are destroyed by their finalizer, the cgo brotli readers are kept
+// in a list and are all closed. Values Put directly in the embedded sync.Pool,
+// as DefaultDeflateReaderDictPool does, are not drained.
+
+// Prewarm puts n new writers of level in the pool of level.
+func (cps *PoolContainer[T]) Prewarm(level, n int) {
+	cps.Pool(level).prewarm(n)
+}
+
+// Drain takes the idle writers of every level out of the pools, the cgo ones
+// are destroyed. It is meant for shutdown, the pools stay usable and create
+// writers again. drained is the number of idle writers taken out.
+func (cps *PoolContainer[T]) Drain() (drained int) {
+	for _, p := range cps.pools {
+		drained += p.drain()
+	}
+	return
+}
+
+func (c *CompressPool[T]) prewarm(n int) {
+	for i := 0; i < n; i++ {
+		c.idle.Put(c.create())
+	}
+}
+
+func (c *CompressPool[T]) drain() (drained int) {
+	for x := c.idle.Get(); x != nil; x = c.idle.Get() {
+		destroyWriter(x.(Writer))
+		drained++
+	}
+	return
+}
+
+// Prewarm puts n new readers in the pool.
+func (b *ReaderPool[T]) Prewarm(n int) {
+	for i := 0; i < n; i++ {
+		b.idle.Put(b.create())
+	}
+}
+
+// Drain takes the idle readers out of the pool, the zstd decoders are closed.
+// It is meant for shutdown, the pool stays usable and creates readers again.
+// drained is the number of idle readers taken out.
+func (b *ReaderPool[T]) Drain() (drained int) {
+	for x := b.idle.Get(); x != nil; x = b.idle.Get() {
+		if zr, ok := x.(ZstdReader); ok {
+			// stops the decoder goroutines, Close of ZstdReader keeps them.
+			zr.Decoder.Close()
+		}
+		drained++
+	}
+	return
+}
+
+// DrainPools drains the default writer and reader pools of every Order, the
+// cgo brotli ones included, e.g. in a graceful shutdown hook. The dictionary
+// pools are left to their owners. drained is the number of idle writers and
+// readers taken out.
+func DrainPools() (drained int) {
+	drained += DefaultGzipCompressPools.Drain()
+	drained += DefaultDeflateCompressPools.Drain()
+	drained += DefaultZstdCompressPools.Drain()
+	drained += DefaultBrotliCompressPools.Drain()
+	drained += DefaultSnappyCompressPools.Drain()
+	drained += DefaultS2CompressPools.Drain()
+	drained += DefaultGzipReaderPool.Drain()
+	drained += DefaultDeflateReaderPool.Drain()
+	drained += DefaultZstdReaderPool.Drain()
+	drained += DefaultBrotliReaderPool.Drain()
+	drained += DefaultSnappyReaderPool.Drain()
+	drained += DefaultS2ReaderPool.Drain()
+	return drained + cgoDrain()
+}
@@ -0,0 +1,64 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPrewarmDrain(t *testing.T) {
+	cps := &PoolContainer[*zlib.Writer]{defaultLevel: zlib.DefaultCompression, offset: 2, poolsInit: deflatePoolsInit(nil)}
+	cps.init()
+	cps.Prewarm(6, 8)
+	p := cps.Pool(6)
+	assert.Eq(t, int64(8), p.Stats().News)
+	cps.Prewarm(1, 8)
+	// best-effort, a writer left on another P's private slot is missed, and
+	// under the race detector Put drops some. Nothing is created to be drained.
+	drained := cps.Drain()
+	assert.Gt(t, drained, 0)
+	assert.Lte(t, drained, 16)
+	assert.Eq(t, int64(8), p.Stats().News)
+	assert.Eq(t, int64(8), cps.Pool(1).Stats().News)
+	// the pools are still usable, New is kept for the embedded sync.Pool.
+	w := p.Get()
+	assert.NotNil(t, w)
+	p.Put(w)
+	_, ok := p.Pool.Get().(*zlib.Writer)
+	assert.True(t, ok)
+}
+
+func TestReaderPoolPrewarmDrain(t *testing.T) {
+	compressed := compressForTest(t, Zstd, -1, []byte(strings.Repeat("drain ", 100)))
+	pool := ReaderPool[ZstdReader]{}
+	pool.New = func() any {
+		r, _ := zstd.NewReader(nil)
+		return ZstdReader{Decoder: r}
+	}
+	pool.Prewarm(8)
+	assert.Eq(t, int64(8), pool.news.Load())
+	drained := pool.Drain()
+	assert.Gt(t, drained, 0)
+	assert.Lte(t, drained, 8)
+	// no decoder was created to be closed.
+	assert.Eq(t, int64(8), pool.news.Load())
+	r, err := newZstdReader(&pool, strings.NewReader(string(compressed)))
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, strings.Repeat("drain ", 100), string(rs))
+	assert.NoErr(t, r.Close())
+}
+
+func TestDrainPools(t *testing.T) {
+	DrainPools()
+	p := DefaultGzipCompressPools.Pool(5)
+	news := p.Stats().News
+	DefaultGzipCompressPools.Prewarm(5, 8)
+	assert.Gt(t, DrainPools(), 0)
+	// draining created no writer.
+	assert.Eq(t, news+8, p.Stats().News)
+}
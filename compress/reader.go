@@ -0,0 +1,127 @@
+package compress
+
+import (
+	"errors"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"io"
+	"sync"
+)
+
+// ErrUnsupportedOrder the Order has no decoder.
+var ErrUnsupportedOrder = errors.New("compress: unsupported order")
+
+var errReaderClosed = errors.New("compress: read on closed reader")
+
+// NewReader returns a decoder of order reading from src, it's the reader side
+// counterpart of Pool. The decoder comes from the matching reader pool and Close
+// returns it there, the result must not be used after Close.
+//
+// Identity returns src as is, with a no-op Close.
+func NewReader(order Order, src io.Reader) (io.ReadCloser, error) {
+	var r io.Reader
+	var err error
+	switch order {
+	case Gzip:
+		gr := DefaultGzipReaderPool.Get()
+		if err = gr.Reset(src); err != nil {
+			_ = gr.Close()
+			DefaultGzipReaderPool.Put(gr)
+			return nil, err
+		}
+		r = gr
+	case Deflate:
+		return newDeflateReader(src, nil)
+	case Zstd:
+		return newZstdReader(&DefaultZstdReaderPool, src)
+	case Snappy:
+		return newS2Reader(&DefaultSnappyReaderPool, src), nil
+	case S2:
+		return newS2Reader(&DefaultS2ReaderPool, src), nil
+	case Br:
+		if r, err = newBrotliReader(src); err != nil {
+			return nil, err
+		}
+	case Identity:
+		return io.NopCloser(src), nil
+	default:
+		return nil, ErrUnsupportedOrder
+	}
+	pr := pooledReaderPool.Get().(*pooledReader)
+	pr.r = r
+	return pr, nil
+}
+
+func newDeflateReader(src io.Reader, dict []byte) (io.ReadCloser, error) {
+	dr := DefaultDeflateReaderPool.Get()
+	if err := dr.ResetDict(src, dict); err != nil {
+		_ = dr.Close()
+		DefaultDeflateReaderPool.Put(dr)
+		return nil, err
+	}
+	pr := pooledReaderPool.Get().(*pooledReader)
+	pr.r = dr
+	return pr, nil
+}
+
+func newZstdReader(pool *ReaderPool[ZstdReader], src io.Reader) (io.ReadCloser, error) {
+	zr := pool.Get()
+	if err := zr.Reset(src); err != nil {
+		_ = zr.Close()
+		pool.Put(zr)
+		return nil, err
+	}
+	pr := pooledReaderPool.Get().(*pooledReader)
+	pr.r = zr
+	pr.zstdPool = pool
+	return pr, nil
+}
+
+var pooledReaderPool = sync.Pool{New: func() any {
+	return &pooledReader{}
+}}
+
+// pooledReader hands the decoder back to its pool on Close.
+type pooledReader struct {
+	r io.Reader
+	// zstdPool owner of a ZstdReader, which can be a dictionary pool.
+	zstdPool *ReaderPool[ZstdReader]
+	// s2Pool owner of a *s2.Reader, Snappy and S2 have a pool each.
+	s2Pool *ReaderPool[*s2.Reader]
+}
+
+func (p *pooledReader) Read(b []byte) (int, error) {
+	if p.r == nil {
+		return 0, errReaderClosed
+	}
+	return p.r.Read(b)
+}
+
+func (p *pooledReader) Close() (err error) {
+	if p.r == nil {
+		return errReaderClosed
+	}
+	switch r := p.r.(type) {
+	case *gzip.Reader:
+		err = r.Close()
+		DefaultGzipReaderPool.Put(r)
+	case DeflateReader:
+		err = r.Close()
+		DefaultDeflateReaderPool.Put(r)
+	case ZstdReader:
+		err = r.Close()
+		p.zstdPool.Put(r)
+	case *s2.Reader:
+		r.Reset(nil)
+		p.s2Pool.Put(r)
+	case *goBrotliReader:
+		err = r.release()
+	default:
+		putCgoReader(r)
+	}
+	p.r = nil
+	p.zstdPool = nil
+	p.s2Pool = nil
+	pooledReaderPool.Put(p)
+	return
+}
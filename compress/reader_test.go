@@ -0,0 +1,54 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/goutils/bytes"
+	"github.com/xyproto/randomstring"
+	"io"
+	"strings"
+	"testing"
+)
+
+func compressForTest(t *testing.T, order Order, level int, src []byte) []byte {
+	p := Pool(level, order)
+	w := p.Get()
+	buf := bytes.Buffer{}
+	w.Reset(&buf)
+	_, err := w.Write(src)
+	assert.NoErr(t, err)
+	assert.NoErr(t, w.Close())
+	p.Put(w)
+	return buf.Bytes()
+}
+
+func TestNewReader(t *testing.T) {
+	dataBytes := []byte(randomstring.HumanFriendlyString(4096))
+	for _, order := range []Order{Gzip, Deflate, Zstd, Br, Snappy, S2} {
+		t.Run(string(order), func(t *testing.T) {
+			compressed := compressForTest(t, order, -1, dataBytes)
+			for i := 0; i < 3; i++ {
+				r, err := NewReader(order, bytes.NewBuffer(compressed))
+				assert.NoErr(t, err)
+				rs, err := io.ReadAll(r)
+				assert.NoErr(t, err)
+				assert.Eq(t, dataBytes, rs)
+				assert.NoErr(t, r.Close())
+			}
+		})
+	}
+}
+
+func TestNewReaderIdentityAndUnknown(t *testing.T) {
+	r, err := NewReader(Identity, strings.NewReader("plain"))
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, "plain", string(rs))
+	assert.NoErr(t, r.Close())
+	//
+	_, err = NewReader("lzw", strings.NewReader("plain"))
+	assert.ErrIs(t, err, ErrUnsupportedOrder)
+	//
+	_, err = NewReader(Gzip, strings.NewReader("not gzip data"))
+	assert.Err(t, err)
+}
@@ -0,0 +1,82 @@
+package compress
+
+import (
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/snappy"
+	"io"
+	"sync"
+)
+
+// Snappy and S2 are stream formats, for RPC payloads and storage rather than
+// HTTP. Both are written by *s2.Writer, Snappy in its snappy compatible mode.
+const (
+	Snappy Order = "snappy"
+	S2     Order = "s2"
+)
+
+const (
+	S2SpeedFastest s2Level = iota + 1
+	S2SpeedBetterCompression
+	S2SpeedBestCompression
+)
+
+type s2Level int
+
+var DefaultSnappyCompressPools = &PoolContainer[*s2.Writer]{
+	defaultLevel: int(S2SpeedFastest),
+	offset:       0,
+	poolsInit:    s2PoolsInit(s2.WriterSnappyCompat()),
+}
+
+var DefaultS2CompressPools = &PoolContainer[*s2.Writer]{
+	defaultLevel: int(S2SpeedFastest),
+	offset:       0,
+	poolsInit:    s2PoolsInit(),
+}
+
+// s2PoolsInit levels past S2SpeedBestCompression are S2SpeedBestCompression.
+// The writers compress on the calling goroutine, a pooled writer serves one
+// stream at a time.
+func s2PoolsInit(opts ...s2.WriterOption) func() [levelCount]*CompressPool[*s2.Writer] {
+	return func() [levelCount]*CompressPool[*s2.Writer] {
+		var pools [levelCount]*CompressPool[*s2.Writer]
+		for i := range pools {
+			wOpts := append([]s2.WriterOption{s2.WriterConcurrency(1)}, opts...)
+			switch {
+			case i >= int(S2SpeedBestCompression):
+				wOpts = append(wOpts, s2.WriterBestCompression())
+			case i == int(S2SpeedBetterCompression):
+				wOpts = append(wOpts, s2.WriterBetterCompression())
+			}
+			pools[i] = &CompressPool[*s2.Writer]{Pool: sync.Pool{
+				New: func() any {
+					return s2.NewWriter(nil, wOpts...)
+				}}}
+		}
+		return pools
+	}
+}
+
+var DefaultSnappyReaderPool ReaderPool[*s2.Reader]
+var DefaultS2ReaderPool ReaderPool[*s2.Reader]
+
+func init() {
+	DefaultSnappyCompressPools.init()
+	DefaultS2CompressPools.init()
+
+	DefaultSnappyReaderPool.New = func() interface{} {
+		return snappy.NewReader(nil)
+	}
+	DefaultS2ReaderPool.New = func() interface{} {
+		return s2.NewReader(nil)
+	}
+}
+
+func newS2Reader(pool *ReaderPool[*s2.Reader], src io.Reader) io.ReadCloser {
+	sr := pool.Get()
+	sr.Reset(src)
+	pr := pooledReaderPool.Get().(*pooledReader)
+	pr.r = sr
+	pr.s2Pool = pool
+	return pr
+}
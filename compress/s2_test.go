@@ -0,0 +1,37 @@
+package compress
+
+import (
+	"bytes"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/snappy"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPoolSnappyS2(t *testing.T) {
+	src := []byte(strings.Repeat(`{"id":42,"method":"Cache.Get","key":"user:1001"}`, 2000))
+	for _, order := range []Order{Snappy, S2} {
+		for _, level := range []int{-1, 0, 1, 2, 3, 11} {
+			compressed := compressForTest(t, order, level, src)
+			assert.Lt(t, len(compressed), len(src)/4)
+			// readable by the upstream stream decoders.
+			var r io.Reader = s2.NewReader(bytes.NewReader(compressed))
+			if order == Snappy {
+				r = snappy.NewReader(bytes.NewReader(compressed))
+			}
+			rs, err := io.ReadAll(r)
+			assert.NoErr(t, err)
+			assert.Eq(t, src, rs)
+			//
+			d, err := AppendDecompressed(nil, compressed, order, 0)
+			assert.NoErr(t, err)
+			assert.Eq(t, src, d)
+		}
+	}
+	//
+	_, err := AppendDecompressed(nil, compressForTest(t, S2, -1, src)[:100], S2, 0)
+	assert.Err(t, err)
+	assert.Eq(t, 2, LevelBetter.Native(Snappy))
+}
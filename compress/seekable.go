@@ -0,0 +1,365 @@
+package compress
+
+import (
+	"encoding/binary"
+	"errors"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io"
+	"math"
+	"sort"
+	"sync"
+)
+
+// The seekable zstd format of the zstd contrib directory: independent frames
+// followed by a skippable frame holding the seek table.
+const (
+	seekTableMagic    = 0x184D2A5E
+	seekableMagic     = 0x8F92EAB1
+	seekFooterSize    = 9
+	seekEntrySize     = 8
+	seekChecksumFlag  = 1 << 7
+	seekReservedBits  = 0x7c
+	skippableHeadSize = 8
+)
+
+// DefaultSeekableFrameSize uncompressed bytes per frame, the unit of random access.
+const DefaultSeekableFrameSize = 1 << 20
+
+// MaxSeekableFrameSize largest uncompressed frame, the limit of zstd's seekable
+// format implementation. A reader holds a whole frame in memory.
+const MaxSeekableFrameSize = 1 << 30
+
+// zstdMaxExpansion most uncompressed bytes per compressed byte, a 4 byte RLE
+// block decodes to a 128 KiB block at most.
+const zstdMaxExpansion = 128 << 10 / 4
+
+// zstdFrameBound largest frame holding dSize bytes: raw blocks of 128 KiB with
+// a 3 byte header, plus the frame header and checksum.
+func zstdFrameBound(dSize int64) int64 {
+	return dSize + 3*(dSize>>17+1) + 18 + 4
+}
+
+var (
+	// ErrNotSeekable the input does not end with a seek table.
+	ErrNotSeekable = errors.New("compress: no zstd seek table")
+	// ErrSeekTable the seek table does not match the input.
+	ErrSeekTable      = errors.New("compress: corrupt zstd seek table")
+	errNegativeOffset = errors.New("compress: negative offset")
+)
+
+// SeekableWriter writes seekable zstd: every FrameSize bytes of input are
+// compressed into a frame of their own with DefaultZstdCompressPools, Close
+// appends the seek table. Standard zstd decoders read the output as one
+// stream, they skip the seek table.
+type SeekableWriter struct {
+	dst       io.Writer
+	level     int
+	frameSize int
+	buf       *bpool.Bytes
+	out       *bpool.Bytes
+	entries   []byte
+	frames    uint32
+	err       error
+	closed    bool
+}
+
+var _ Writer = (*SeekableWriter)(nil)
+
+// NewSeekableWriter frameSize 0 or above MaxSeekableFrameSize means
+// DefaultSeekableFrameSize, level is the level passed to Pool.
+func NewSeekableWriter(dst io.Writer, level, frameSize int) *SeekableWriter {
+	if frameSize <= 0 || frameSize > MaxSeekableFrameSize {
+		frameSize = DefaultSeekableFrameSize
+	}
+	return &SeekableWriter{dst: dst, level: level, frameSize: frameSize}
+}
+
+func (s *SeekableWriter) Write(p []byte) (n int, err error) {
+	if s.closed {
+		return 0, errWriterClosed
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	for len(p) > 0 {
+		if s.buf == nil {
+			s.buf = bpool.Get(s.frameSize)
+		}
+		m := min(s.frameSize-s.buf.Len(), len(p))
+		s.buf.B = append(s.buf.B, p[:m]...)
+		p = p[m:]
+		n += m
+		if s.buf.Len() == s.frameSize {
+			if err = s.writeFrame(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Flush ends the current frame early.
+func (s *SeekableWriter) Flush() error {
+	if s.closed {
+		return errWriterClosed
+	}
+	return s.flush()
+}
+
+// Close writes the last frame and the seek table, it does not close dst.
+func (s *SeekableWriter) Close() error {
+	if s.closed {
+		return errWriterClosed
+	}
+	s.closed = true
+	err := s.flush()
+	if err == nil {
+		err = s.writeSeekTable()
+	}
+	s.release()
+	return err
+}
+
+// Reset discards the state, s then writes to dst.
+func (s *SeekableWriter) Reset(dst io.Writer) {
+	s.release()
+	*s = SeekableWriter{dst: dst, level: s.level, frameSize: s.frameSize, entries: s.entries[:0]}
+}
+
+func (s *SeekableWriter) flush() error {
+	if s.err == nil && s.buf != nil && s.buf.Len() > 0 {
+		return s.writeFrame()
+	}
+	return s.err
+}
+
+func (s *SeekableWriter) writeFrame() (err error) {
+	if s.frames == math.MaxUint32 {
+		s.err = ErrSeekTable
+		return s.err
+	}
+	if s.out == nil {
+		s.out = bpool.Get(s.frameSize/2 + 64)
+	}
+	s.out.B, err = AppendCompressed(s.out.B[:0], s.buf.B, Zstd, s.level)
+	if err == nil {
+		_, err = s.dst.Write(s.out.B)
+	}
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.entries = binary.LittleEndian.AppendUint32(s.entries, uint32(s.out.Len()))
+	s.entries = binary.LittleEndian.AppendUint32(s.entries, uint32(s.buf.Len()))
+	s.frames++
+	s.buf.B = s.buf.B[:0]
+	return
+}
+
+func (s *SeekableWriter) writeSeekTable() error {
+	table := make([]byte, 0, skippableHeadSize+len(s.entries)+seekFooterSize)
+	table = binary.LittleEndian.AppendUint32(table, seekTableMagic)
+	table = binary.LittleEndian.AppendUint32(table, uint32(len(s.entries)+seekFooterSize))
+	table = append(table, s.entries...)
+	table = binary.LittleEndian.AppendUint32(table, s.frames)
+	table = append(table, 0)
+	table = binary.LittleEndian.AppendUint32(table, seekableMagic)
+	_, err := s.dst.Write(table)
+	return err
+}
+
+func (s *SeekableWriter) release() {
+	if s.buf != nil {
+		bpool.Put(s.buf)
+		s.buf = nil
+	}
+	if s.out != nil {
+		bpool.Put(s.out)
+		s.out = nil
+	}
+}
+
+type seekFrame struct {
+	// cOff and dOff offsets of the frame in the compressed and the
+	// decompressed data.
+	cOff, dOff   int64
+	cSize, dSize int64
+}
+
+// SeekableReader random access to seekable zstd through its seek table, each
+// frame is decoded with a DefaultZstdReaderPool decoder. ReadAt is safe for
+// concurrent use, Read and Seek share an offset. The last frame decoded is
+// kept, sequential reads decode every frame once.
+type SeekableReader struct {
+	r      io.ReaderAt
+	frames []seekFrame
+	size   int64
+	pos    int64
+	mu     sync.Mutex
+	// cached the index of the frame in cache, -1 for none.
+	cached int
+	cache  *bpool.Bytes
+}
+
+var (
+	_ io.ReaderAt       = (*SeekableReader)(nil)
+	_ io.ReadSeekCloser = (*SeekableReader)(nil)
+)
+
+// NewSeekableReader reads the seek table at the end of r, size bytes long. A
+// frame larger than MaxSeekableFrameSize, or than its compressed size can
+// decode to, is ErrSeekTable.
+func NewSeekableReader(r io.ReaderAt, size int64) (*SeekableReader, error) {
+	if size < skippableHeadSize+seekFooterSize {
+		return nil, ErrNotSeekable
+	}
+	var footer [seekFooterSize]byte
+	if _, err := r.ReadAt(footer[:], size-seekFooterSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableMagic {
+		return nil, ErrNotSeekable
+	}
+	if footer[4]&seekReservedBits != 0 {
+		return nil, ErrSeekTable
+	}
+	n := int64(binary.LittleEndian.Uint32(footer[:4]))
+	entrySize := int64(seekEntrySize)
+	if footer[4]&seekChecksumFlag != 0 {
+		entrySize += 4
+	}
+	tableSize := n*entrySize + seekFooterSize
+	if tableSize+skippableHeadSize > size {
+		return nil, ErrSeekTable
+	}
+	table := make([]byte, skippableHeadSize+tableSize)
+	if _, err := r.ReadAt(table, size-int64(len(table))); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(table) != seekTableMagic ||
+		int64(binary.LittleEndian.Uint32(table[4:])) != tableSize {
+		return nil, ErrSeekTable
+	}
+	s := &SeekableReader{r: r, frames: make([]seekFrame, n), cached: -1}
+	var cOff int64
+	entries := table[skippableHeadSize:]
+	for i := range s.frames {
+		e := entries[int64(i)*entrySize:]
+		f := seekFrame{
+			cOff:  cOff,
+			dOff:  s.size,
+			cSize: int64(binary.LittleEndian.Uint32(e)),
+			dSize: int64(binary.LittleEndian.Uint32(e[4:])),
+		}
+		// the frame is read into a buffer of cSize and decoded into one of
+		// dSize.
+		if f.dSize > MaxSeekableFrameSize || (f.cSize == 0 && f.dSize > 0) ||
+			f.dSize > f.cSize*zstdMaxExpansion || f.cSize > zstdFrameBound(f.dSize) {
+			return nil, ErrSeekTable
+		}
+		s.frames[i] = f
+		cOff += f.cSize
+		s.size += f.dSize
+	}
+	if cOff != size-int64(len(table)) {
+		return nil, ErrSeekTable
+	}
+	return s, nil
+}
+
+// Size the decompressed size.
+func (s *SeekableReader) Size() int64 {
+	return s.size
+}
+
+// NumFrames frames in the seek table.
+func (s *SeekableReader) NumFrames() int {
+	return len(s.frames)
+}
+
+func (s *SeekableReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if off >= s.size {
+		return 0, io.EOF
+	}
+	i := sort.Search(len(s.frames), func(i int) bool {
+		return s.frames[i].dOff+s.frames[i].dSize > off
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ; n < len(p) && i < len(s.frames); i++ {
+		if err = s.decode(i); err != nil {
+			return
+		}
+		f := s.frames[i]
+		n += copy(p[n:], s.cache.B[off+int64(n)-f.dOff:])
+	}
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+func (s *SeekableReader) Read(p []byte) (n int, err error) {
+	n, err = s.ReadAt(p, s.pos)
+	s.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return
+}
+
+func (s *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+// Close gives back the cached frame, it does not close the underlying reader.
+func (s *SeekableReader) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cache != nil {
+		bpool.Put(s.cache)
+		s.cache = nil
+		s.cached = -1
+	}
+	return nil
+}
+
+// decode frame i into the cache, s.mu is held.
+func (s *SeekableReader) decode(i int) (err error) {
+	if s.cached == i {
+		return nil
+	}
+	f := s.frames[i]
+	src := bpool.Get(int(f.cSize))
+	defer bpool.Put(src)
+	src.B = src.B[:f.cSize]
+	if _, err = s.r.ReadAt(src.B, f.cOff); err != nil {
+		return
+	}
+	if s.cache == nil {
+		s.cache = bpool.Get(int(f.dSize))
+	}
+	s.cached = -1
+	s.cache.B, err = AppendDecompressed(s.cache.B[:0], src.B, Zstd, int(f.dSize))
+	if err != nil {
+		return
+	}
+	if int64(s.cache.Len()) != f.dSize {
+		return ErrSeekTable
+	}
+	s.cached = i
+	return
+}
@@ -0,0 +1,118 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSeekableZstd(t *testing.T) {
+	sb := strings.Builder{}
+	for i := 0; sb.Len() < 100<<10; i++ {
+		_, _ = fmt.Fprintf(&sb, "2024-10-20T12:00:00Z level=info msg=%q n=%d\n", "request served", i)
+	}
+	src := sb.String()
+	buf := bytes.Buffer{}
+	w := NewSeekableWriter(&buf, -1, 8<<10)
+	for i := 0; i < len(src); i += 5000 {
+		_, err := w.Write([]byte(src[i:min(i+5000, len(src))]))
+		assert.NoErr(t, err)
+	}
+	assert.NoErr(t, w.Close())
+	archive := buf.Bytes()
+	// plain decoders skip the seek table.
+	zr, err := zstd.NewReader(bytes.NewBuffer(archive))
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(zr)
+	assert.NoErr(t, err)
+	zr.Close()
+	assert.Eq(t, src, string(rs))
+	//
+	r, err := NewSeekableReader(strings.NewReader(string(archive)), int64(len(archive)))
+	assert.NoErr(t, err)
+	assert.Eq(t, int64(len(src)), r.Size())
+	assert.Eq(t, (len(src)+8<<10-1)/(8<<10), r.NumFrames())
+	for _, off := range []int{0, 1, 8<<10 - 3, 50000, len(src) - 10} {
+		p := make([]byte, 20000)
+		n, err := r.ReadAt(p, int64(off))
+		want := src[off:min(off+len(p), len(src))]
+		assert.Eq(t, len(want), n)
+		assert.Eq(t, want, string(p[:n]))
+		if n < len(p) {
+			assert.ErrIs(t, err, io.EOF)
+		} else {
+			assert.NoErr(t, err)
+		}
+	}
+	_, err = r.ReadAt(make([]byte, 1), int64(len(src)))
+	assert.ErrIs(t, err, io.EOF)
+	//
+	pos, err := r.Seek(-100, io.SeekEnd)
+	assert.NoErr(t, err)
+	assert.Eq(t, int64(len(src)-100), pos)
+	rs, err = io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, src[len(src)-100:], string(rs))
+	_, _ = r.Seek(0, io.SeekStart)
+	rs, err = io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, src, string(rs))
+	assert.NoErr(t, r.Close())
+	//
+	_, err = NewSeekableReader(strings.NewReader(src), int64(len(src)))
+	assert.ErrIs(t, err, ErrNotSeekable)
+	_, err = NewSeekableReader(bytes.NewReader(archive[100:]), int64(len(archive)-100))
+	assert.ErrIs(t, err, ErrSeekTable)
+}
+
+func TestSeekableZstdEmpty(t *testing.T) {
+	buf := bytes.Buffer{}
+	w := NewSeekableWriter(&buf, -1, 0)
+	assert.NoErr(t, w.Close())
+	r, err := NewSeekableReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoErr(t, err)
+	assert.Eq(t, int64(0), r.Size())
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Empty(t, rs)
+}
+
+func TestSeekableZstdCorruptTable(t *testing.T) {
+	buf := bytes.Buffer{}
+	w := NewSeekableWriter(&buf, -1, 0)
+	// zeros reach the highest ratio zstd has.
+	_, err := w.Write(make([]byte, 4<<20))
+	assert.NoErr(t, err)
+	assert.NoErr(t, w.Close())
+	archive := buf.Bytes()
+	r, err := NewSeekableReader(bytes.NewReader(archive), int64(len(archive)))
+	assert.NoErr(t, err)
+	assert.Eq(t, int64(4<<20), r.Size())
+	//
+	entry := len(archive) - seekFooterSize - 4*seekEntrySize
+	cSize := binary.LittleEndian.Uint32(archive[entry:])
+	for _, dSize := range []uint32{math.MaxUint32, cSize*zstdMaxExpansion + 1} {
+		corrupt := bytes.Clone(archive)
+		binary.LittleEndian.PutUint32(corrupt[entry+4:], dSize)
+		_, err = NewSeekableReader(bytes.NewReader(corrupt), int64(len(corrupt)))
+		assert.ErrIs(t, err, ErrSeekTable)
+	}
+	// cSize 0 for a frame with content, and more than the frame can take.
+	for _, c := range []uint32{0, zstdMaxExpansion << 10} {
+		corrupt := bytes.Clone(archive)
+		binary.LittleEndian.PutUint32(corrupt[entry:], c)
+		_, err = NewSeekableReader(bytes.NewReader(corrupt), int64(len(corrupt)))
+		assert.ErrIs(t, err, ErrSeekTable)
+	}
+	// reserved descriptor bits.
+	corrupt := bytes.Clone(archive)
+	corrupt[len(corrupt)-5] |= 1 << 2
+	_, err = NewSeekableReader(bytes.NewReader(corrupt), int64(len(corrupt)))
+	assert.ErrIs(t, err, ErrSeekTable)
+}
@@ -0,0 +1,266 @@
+package compress
+
+import (
+	"container/list"
+	"errors"
+	ghttp "github.com/newacorn/goutils/http"
+	"github.com/newacorn/goutils/unsafefn"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNotCompressible the file's content type is not worth compressing.
+var ErrNotCompressible = errors.New("compress: content type not compressible")
+
+// DefaultStaticCacheMaxBytes memory budget of a StaticCache with MaxBytes unset.
+const DefaultStaticCacheMaxBytes = 64 << 20
+
+// StaticCache keeps compressed copies of static files in memory, keyed by path
+// and the writer pool of Order and level, levels sharing a pool share the
+// entry. An entry is recompressed once the file's mtime or size has changed,
+// concurrent Gets of an entry being compressed wait for it. Compressed bytes
+// live in *bpool.Bytes, the total is bounded by MaxBytes and the least
+// recently used entries are evicted first.
+//
+// The zero value is ready to use.
+type StaticCache struct {
+	// MaxBytes 0 means DefaultStaticCacheMaxBytes.
+	MaxBytes int64
+	// MimeOk decides from the content type found by file extension whether a
+	// file is cached, nil means CheckMimeOk.
+	MimeOk func(mime []byte) bool
+	mu     sync.Mutex
+	items  map[staticKey]*list.Element
+	loads  map[staticKey]*staticLoad
+	lru    list.List
+	size   int64
+}
+
+type staticKey struct {
+	path string
+	pool Pooler
+}
+
+// staticLoad an entry being compressed, done is closed once e or err is set.
+type staticLoad struct {
+	modTime int64
+	size    int64
+	waiters int32
+	done    chan struct{}
+	e       *StaticEntry
+	err     error
+}
+
+// StaticEntry compressed content of a file. It stays valid, even when evicted
+// meanwhile, until Release is called.
+type StaticEntry struct {
+	key     staticKey
+	data    *bpool.Bytes
+	modTime int64
+	size    int64
+	cost    int64
+	// one reference is held by the cache while the entry is cached.
+	refs atomic.Int32
+}
+
+// Bytes the compressed content.
+func (e *StaticEntry) Bytes() []byte {
+	return e.data.B
+}
+
+// Len compressed length.
+func (e *StaticEntry) Len() int {
+	return len(e.data.B)
+}
+
+// SourceSize size of the file the entry was made from.
+func (e *StaticEntry) SourceSize() int64 {
+	return e.size
+}
+
+// WriteTo implements io.WriterTo.
+func (e *StaticEntry) WriteTo(w io.Writer) (int64, error) {
+	return e.data.WriteTo(w)
+}
+
+// Release gives the entry back, it must not be used afterward.
+func (e *StaticEntry) Release() {
+	if e.refs.Add(-1) == 0 {
+		bpool.Put(e.data)
+		e.data = nil
+	}
+}
+
+// Get returns the content of the file at path compressed with order at level,
+// from the cache when it's still fresh. Files whose content type is not
+// compressible give ErrNotCompressible. The caller must Release the entry.
+func (c *StaticCache) Get(path string, order Order, level int) (*StaticEntry, error) {
+	mimeOk := c.MimeOk
+	if mimeOk == nil {
+		mimeOk = CheckMimeOk
+	}
+	mime := ghttp.TypeByExtension(filepath.Ext(path), "")
+	if !mimeOk(unsafefn.S2B(mime)) {
+		return nil, ErrNotCompressible
+	}
+	p := Pool(level, order)
+	if p == nil {
+		return nil, ErrUnsupportedOrder
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	key := staticKey{path: path, pool: p}
+	modTime := fi.ModTime().UnixNano()
+	e, l, wait := c.lookup(key, modTime, fi.Size())
+	if e != nil {
+		return e, nil
+	}
+	if wait {
+		<-l.done
+		return l.e, l.err
+	}
+	//
+	e, err = c.load(key, p, f, modTime, fi.Size())
+	if l != nil {
+		c.mu.Lock()
+		delete(c.loads, key)
+		if err == nil {
+			e.refs.Add(l.waiters)
+		}
+		c.mu.Unlock()
+		l.e, l.err = e, err
+		close(l.done)
+	}
+	return e, err
+}
+
+func (c *StaticCache) load(key staticKey, p Pooler, f *os.File, modTime, size int64) (*StaticEntry, error) {
+	data := bpool.Get(int(size/2) + 64)
+	w := p.Get()
+	w.Reset(data)
+	_, err := bpool.Copy(w, f)
+	if err == nil {
+		err = w.Close()
+	}
+	putWriter(p, w, err == nil)
+	if err != nil {
+		bpool.Put(data)
+		return nil, err
+	}
+	RecordBytes(p, size, int64(data.Len()))
+	e := &StaticEntry{key: key, data: data, modTime: modTime, size: size}
+	e.refs.Store(1)
+	c.add(e)
+	return e, nil
+}
+
+// lookup returns the cached entry when it's fresh. Otherwise l is the load of
+// the entry, wait reports that another Get runs it, else the caller does. l is
+// nil when a load of other file content is running, the caller compresses on
+// its own.
+func (c *StaticCache) lookup(key staticKey, modTime, size int64) (e *StaticEntry, l *staticLoad, wait bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		e = el.Value.(*StaticEntry)
+		if e.modTime == modTime && e.size == size {
+			c.lru.MoveToFront(el)
+			e.refs.Add(1)
+			return e, nil, false
+		}
+		c.removeLocked(el)
+		e = nil
+	}
+	if l, ok := c.loads[key]; ok {
+		if l.modTime != modTime || l.size != size {
+			return nil, nil, false
+		}
+		l.waiters++
+		return nil, l, true
+	}
+	if c.loads == nil {
+		c.loads = make(map[staticKey]*staticLoad)
+	}
+	l = &staticLoad{modTime: modTime, size: size, done: make(chan struct{})}
+	c.loads[key] = l
+	return nil, l, false
+}
+
+func (c *StaticCache) add(e *StaticEntry) {
+	maxBytes := c.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultStaticCacheMaxBytes
+	}
+	e.cost = int64(cap(e.data.B))
+	if e.cost > maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.items == nil {
+		c.items = make(map[staticKey]*list.Element)
+	}
+	if el, ok := c.items[e.key]; ok {
+		c.removeLocked(el)
+	}
+	for c.size+e.cost > maxBytes {
+		c.removeLocked(c.lru.Back())
+	}
+	e.refs.Add(1)
+	c.items[e.key] = c.lru.PushFront(e)
+	c.size += e.cost
+}
+
+func (c *StaticCache) removeLocked(el *list.Element) {
+	e := c.lru.Remove(el).(*StaticEntry)
+	delete(c.items, e.key)
+	c.size -= e.cost
+	e.Release()
+}
+
+// Invalidate drops every entry of path.
+func (c *StaticCache) Invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*StaticEntry).key.path == path {
+			c.removeLocked(el)
+		}
+		el = next
+	}
+}
+
+// Purge drops every entry.
+func (c *StaticCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.lru.Front(); el != nil; el = c.lru.Front() {
+		c.removeLocked(el)
+	}
+}
+
+// Len number of cached entries.
+func (c *StaticCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Size bytes held by cached entries.
+func (c *StaticCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
@@ -0,0 +1,142 @@
+package compress
+
+import (
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/goutils/bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStaticCache(t *testing.T) {
+	c := &StaticCache{}
+	path := "testdata/jquery-3.7.1.js"
+	src, err := os.ReadFile(path)
+	assert.NoErr(t, err)
+	//
+	e, err := c.Get(path, Gzip, 6)
+	assert.NoErr(t, err)
+	assert.Eq(t, int64(len(src)), e.SourceSize())
+	assert.Lt(t, e.Len(), len(src))
+	r, err := NewReader(Gzip, bytes.NewBuffer(e.Bytes()))
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, src, rs)
+	assert.NoErr(t, r.Close())
+	//
+	e2, err := c.Get(path, Gzip, 6)
+	assert.NoErr(t, err)
+	assert.Eq(t, e, e2)
+	e2.Release()
+	e.Release()
+	//
+	e3, err := c.Get(path, Zstd, 3)
+	assert.NoErr(t, err)
+	assert.NotEq(t, e, e3)
+	e3.Release()
+	assert.Eq(t, 2, c.Len())
+	//
+	// out of range levels use the default level's pool and entry.
+	e4, err := c.Get(path, Gzip, -1)
+	assert.NoErr(t, err)
+	e5, err := c.Get(path, Gzip, 42)
+	assert.NoErr(t, err)
+	assert.Eq(t, e4, e5)
+	e4.Release()
+	e5.Release()
+	assert.Eq(t, 3, c.Len())
+	//
+	_, err = c.Get("testdata/b.png", Gzip, 6)
+	assert.ErrIs(t, err, ErrNotCompressible)
+}
+
+func TestStaticCacheConcurrentLoad(t *testing.T) {
+	c := &StaticCache{}
+	path := "testdata/jquery-3.7.1.js"
+	start := make(chan struct{})
+	es := make([]*StaticEntry, 8)
+	wg := sync.WaitGroup{}
+	for i := range es {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			e, err := c.Get(path, Br, 5)
+			assert.NoErr(t, err)
+			es[i] = e
+		}()
+	}
+	close(start)
+	wg.Wait()
+	// one compression, every Get shares its entry.
+	assert.Gt(t, es[0].Len(), 0)
+	for _, e := range es {
+		assert.Eq(t, es[0], e)
+		e.Release()
+	}
+	assert.Eq(t, 1, c.Len())
+	c.Purge()
+}
+
+func TestStaticCacheInvalidate(t *testing.T) {
+	c := &StaticCache{}
+	path := filepath.Join(t.TempDir(), "a.css")
+	assert.NoErr(t, os.WriteFile(path, []byte("body{color:red}"), 0o644))
+	e, err := c.Get(path, Gzip, 6)
+	assert.NoErr(t, err)
+	e.Release()
+	//
+	assert.NoErr(t, os.WriteFile(path, []byte("body{color:blue}"), 0o644))
+	assert.NoErr(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	e2, err := c.Get(path, Gzip, 6)
+	assert.NoErr(t, err)
+	assert.NotEq(t, e, e2)
+	r, err := NewReader(Gzip, bytes.NewBuffer(e2.Bytes()))
+	assert.NoErr(t, err)
+	rs, err := io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.Eq(t, "body{color:blue}", string(rs))
+	assert.NoErr(t, r.Close())
+	e2.Release()
+	assert.Eq(t, 1, c.Len())
+	//
+	c.Invalidate(path)
+	assert.Eq(t, 0, c.Len())
+	assert.Eq(t, int64(0), c.Size())
+}
+
+func TestStaticCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	c := &StaticCache{MaxBytes: 1 << 16}
+	var held *StaticEntry
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(dir, string(rune('a'+i))+".txt")
+		data := make([]byte, 1<<14)
+		for j := range data {
+			data[j] = byte(j * i)
+		}
+		assert.NoErr(t, os.WriteFile(path, data, 0o644))
+		e, err := c.Get(path, Gzip, 1)
+		assert.NoErr(t, err)
+		if i == 0 {
+			held = e
+			continue
+		}
+		e.Release()
+	}
+	assert.True(t, c.Size() <= 1<<16)
+	assert.Lt(t, c.Len(), 20)
+	// an evicted entry stays readable until released.
+	r, err := NewReader(Gzip, bytes.NewBuffer(held.Bytes()))
+	assert.NoErr(t, err)
+	_, err = io.ReadAll(r)
+	assert.NoErr(t, err)
+	assert.NoErr(t, r.Close())
+	held.Release()
+	c.Purge()
+	assert.Eq(t, 0, c.Len())
+}
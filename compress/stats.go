@@ -0,0 +1,151 @@
+package compress
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"sync/atomic"
+)
+
+// poolCounters usage counters of a CompressPool.
+type poolCounters struct {
+	gets     atomic.Int64
+	puts     atomic.Int64
+	news     atomic.Int64
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+}
+
+// LevelStats snapshot of the counters of the pool of one level.
+type LevelStats struct {
+	Level int
+	// Gets writers handed out by Get.
+	Gets int64
+	// Puts writers given back by Put.
+	Puts int64
+	// News writers created because the pool was empty.
+	News int64
+	// BytesIn uncompressed bytes reported by AddBytes.
+	BytesIn int64
+	// BytesOut compressed bytes reported by AddBytes.
+	BytesOut int64
+}
+
+// Ratio BytesOut/BytesIn, 0 when nothing was reported.
+func (s LevelStats) Ratio() float64 {
+	if s.BytesIn == 0 {
+		return 0
+	}
+	return float64(s.BytesOut) / float64(s.BytesIn)
+}
+
+func (s LevelStats) zero() bool {
+	return s.Gets == 0 && s.Puts == 0 && s.News == 0 && s.BytesIn == 0 && s.BytesOut == 0
+}
+
+// AddBytes reports in uncompressed bytes compressed into out bytes by a writer
+// of c. The pools can not see the data, callers report it after Close.
+func (c *CompressPool[T]) AddBytes(in, out int64) {
+	c.counters.bytesIn.Add(in)
+	c.counters.bytesOut.Add(out)
+}
+
+// Stats snapshot of the counters of c, Level is left to the caller.
+func (c *CompressPool[T]) Stats() LevelStats {
+	return LevelStats{
+		Gets:     c.counters.gets.Load(),
+		Puts:     c.counters.puts.Load(),
+		News:     c.counters.news.Load(),
+		BytesIn:  c.counters.bytesIn.Load(),
+		BytesOut: c.counters.bytesOut.Load(),
+	}
+}
+
+// Stats snapshot of every level of cps, in level order.
+func (cps *PoolContainer[T]) Stats() []LevelStats {
+	stats := make([]LevelStats, 0, levelCount)
+	for i, p := range cps.pools {
+		if p == nil {
+			continue
+		}
+		s := p.Stats()
+		s.Level = i - cps.offset
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// RecordBytes calls AddBytes of p when it is one of the package's pools.
+func RecordBytes(p Pooler, in, out int64) {
+	if r, ok := p.(interface{ AddBytes(in, out int64) }); ok {
+		r.AddBytes(in, out)
+	}
+}
+
+// PoolStats the levels of a named PoolContainer.
+type PoolStats struct {
+	Name   string
+	Levels []LevelStats
+}
+
+// Stats snapshot of the default pools, named after their Order. The cgo
+// brotli pools are "br", only in cgo builds, the pure go ones "brotli".
+func Stats() []PoolStats {
+	return append([]PoolStats{
+		{Name: string(Gzip), Levels: DefaultGzipCompressPools.Stats()},
+		{Name: Deflate, Levels: DefaultDeflateCompressPools.Stats()},
+		{Name: Zstd, Levels: DefaultZstdCompressPools.Stats()},
+		{Name: "brotli", Levels: DefaultBrotliCompressPools.Stats()},
+		{Name: string(Snappy), Levels: DefaultSnappyCompressPools.Stats()},
+		{Name: string(S2), Levels: DefaultS2CompressPools.Stats()},
+	}, cgoStats()...)
+}
+
+// WritePrometheus writes stats in the Prometheus text exposition format.
+// Levels that were never used are left out.
+//
+//	compress.WritePrometheus(w, compress.Stats())
+func WritePrometheus(w io.Writer, stats []PoolStats) error {
+	bw := bufio.NewWriter(w)
+	metrics := [...]struct {
+		name, help string
+		value      func(LevelStats) int64
+	}{
+		{"compress_pool_gets_total", "Writers taken from the pool.", func(s LevelStats) int64 { return s.Gets }},
+		{"compress_pool_puts_total", "Writers returned to the pool.", func(s LevelStats) int64 { return s.Puts }},
+		{"compress_pool_news_total", "Writers allocated by the pool.", func(s LevelStats) int64 { return s.News }},
+		{"compress_pool_bytes_in_total", "Uncompressed bytes written.", func(s LevelStats) int64 { return s.BytesIn }},
+		{"compress_pool_bytes_out_total", "Compressed bytes produced.", func(s LevelStats) int64 { return s.BytesOut }},
+	}
+	var num []byte
+	for _, m := range metrics {
+		_, _ = bw.WriteString("# HELP " + m.name + " " + m.help + "\n# TYPE " + m.name + " counter\n")
+		for _, ps := range stats {
+			for _, s := range ps.Levels {
+				if s.zero() {
+					continue
+				}
+				_, _ = bw.WriteString(m.name + `{pool="` + ps.Name + `",level="`)
+				num = strconv.AppendInt(num[:0], int64(s.Level), 10)
+				_, _ = bw.Write(num)
+				_, _ = bw.WriteString(`"} `)
+				num = strconv.AppendInt(num[:0], m.value(s), 10)
+				_, _ = bw.Write(num)
+				_ = bw.WriteByte('\n')
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// countWriter counts the bytes written through to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += int64(n)
+	return
+}
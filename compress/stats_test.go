@@ -0,0 +1,56 @@
+package compress
+
+import (
+	"bytes"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/klauspost/compress/zlib"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPoolStats(t *testing.T) {
+	c := &PoolContainer[*zlib.Writer]{
+		defaultLevel: zlib.DefaultCompression,
+		offset:       2,
+		poolsInit:    DefaultDeflateCompressPools.poolsInit,
+	}
+	c.init()
+	p := c.Pool(zlib.BestSpeed)
+	w1, w2 := p.Get(), p.Get()
+	p.Put(w1)
+	p.Put(w2)
+	RecordBytes(p, 1000, 100)
+	//
+	stats := c.Stats()
+	assert.Len(t, stats, levelCount)
+	s := stats[zlib.BestSpeed+2]
+	assert.Eq(t, zlib.BestSpeed, s.Level)
+	assert.Eq(t, int64(2), s.Gets)
+	assert.Eq(t, int64(2), s.Puts)
+	assert.Eq(t, int64(2), s.News)
+	assert.Eq(t, 0.1, s.Ratio())
+	assert.Eq(t, int64(0), stats[0].Gets)
+	//
+	buf := bytes.Buffer{}
+	assert.NoErr(t, WritePrometheus(&buf, []PoolStats{{Name: "test", Levels: stats}}))
+	out := buf.String()
+	assert.StrContains(t, out, "# TYPE compress_pool_gets_total counter\n")
+	assert.StrContains(t, out, `compress_pool_gets_total{pool="test",level="1"} 2`+"\n")
+	assert.StrContains(t, out, `compress_pool_bytes_out_total{pool="test",level="1"} 100`+"\n")
+	assert.False(t, strings.Contains(out, `level="0"`))
+}
+
+func TestHandlerRecordsBytes(t *testing.T) {
+	body := strings.Repeat("<p>hello world</p>", 200)
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(body))
+	}), HandlerOptions{})
+	before := DefaultGzipCompressPools.Pool(-1).Stats()
+	rec := serveCompressed(h, "gzip")
+	after := DefaultGzipCompressPools.Pool(-1).Stats()
+	assert.Eq(t, int64(len(body)), after.BytesIn-before.BytesIn)
+	assert.Eq(t, int64(rec.Body.Len()), after.BytesOut-before.BytesOut)
+	assert.Eq(t, after.Gets-before.Gets, after.Puts-before.Puts)
+}
@@ -0,0 +1,178 @@
+package compress
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	gio "github.com/newacorn/goutils/io"
+	bpool "github.com/newacorn/simple-bytes-pool"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultWorkerQueueDepth jobs waiting for a worker.
+const DefaultWorkerQueueDepth = 64
+
+var (
+	// ErrQueueFull the queue of a non blocking Workers is full.
+	ErrQueueFull = errors.New("compress: worker queue full")
+	// ErrWorkersClosed Submit after Close.
+	ErrWorkersClosed = errors.New("compress: workers closed")
+)
+
+// CompressInfo a job of Workers, src is compressed into pw.
+//
+//goland:noinspection GoNameStartsWithPackageName
+type CompressInfo struct {
+	level int
+	order Order
+	pw    *gio.PipeWriter
+	src   io.Reader
+}
+
+//goland:noinspection GoNameStartsWithPackageName
+type CompressInfoChan chan *CompressInfo
+
+// WorkerOptions configures NewWorkers, the zero value is ready to use.
+type WorkerOptions struct {
+	// Workers goroutines compressing, 0 means GOMAXPROCS.
+	Workers int
+	// QueueDepth jobs accepted while all workers are busy, 0 means
+	// DefaultWorkerQueueDepth.
+	QueueDepth int
+	// Block makes Submit wait for room in the queue, by default it fails with
+	// ErrQueueFull.
+	Block bool
+	// PipeSize buffer size of the output pipes, 0 for the pipe default.
+	PipeSize int
+}
+
+// Workers a fixed number of goroutines compressing submitted sources with the
+// pools, it bounds the CPU spent on compression. The output of every job is
+// read from the pipe Submit returns, a worker waits on that pipe while the
+// reader lags behind.
+type Workers struct {
+	jobs CompressInfoChan
+	opts WorkerOptions
+	// mu Submit holds it shared, Close exclusively before closing jobs.
+	mu     sync.RWMutex
+	done   chan struct{}
+	closed atomic.Bool
+	wg     sync.WaitGroup
+}
+
+// NewWorkers starts the workers.
+func NewWorkers(opts WorkerOptions) *Workers {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.QueueDepth <= 0 {
+		opts.QueueDepth = DefaultWorkerQueueDepth
+	}
+	w := &Workers{
+		jobs: make(CompressInfoChan, opts.QueueDepth),
+		opts: opts,
+		done: make(chan struct{}),
+	}
+	w.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go w.run()
+	}
+	return w
+}
+
+// Submit queues the compression of src with the order pool of level. The
+// result has to be read to EOF or closed, otherwise the worker stays blocked
+// on it. ctx bounds the wait of a blocking Workers for room in the queue.
+func (w *Workers) Submit(ctx context.Context, src io.Reader, order Order, level int) (*gio.PipeReader, error) {
+	if Pool(level, order) == nil {
+		return nil, ErrUnsupportedOrder
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed.Load() {
+		return nil, ErrWorkersClosed
+	}
+	var pr *gio.PipeReader
+	job := &CompressInfo{level: level, order: order, src: src}
+	if w.opts.PipeSize > 0 {
+		pr, job.pw = gio.PipeWithSize(w.opts.PipeSize)
+	} else {
+		pr, job.pw = gio.Pipe()
+	}
+	if !w.opts.Block {
+		select {
+		case w.jobs <- job:
+			return pr, nil
+		default:
+			return nil, ErrQueueFull
+		}
+	}
+	select {
+	case w.jobs <- job:
+		return pr, nil
+	case <-w.done:
+		return nil, ErrWorkersClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Queued jobs waiting for a worker.
+func (w *Workers) Queued() int {
+	return len(w.jobs)
+}
+
+// Close stops accepting jobs and waits for the queued ones to finish.
+func (w *Workers) Close() error {
+	if !w.closed.CompareAndSwap(false, true) {
+		return ErrWorkersClosed
+	}
+	// wakes the blocked Submit calls, which hold mu.
+	close(w.done)
+	w.mu.Lock()
+	close(w.jobs)
+	w.mu.Unlock()
+	w.wg.Wait()
+	return nil
+}
+
+func (w *Workers) run() {
+	defer w.wg.Done()
+	for job := range w.jobs {
+		compressJob(job)
+	}
+}
+
+// compressJob closes the pipe with the error of the job, if any.
+func compressJob(job *CompressInfo) {
+	p := Pool(job.level, job.order)
+	cw := p.Get()
+	out := countWriter{w: job.pw}
+	var bw *bufio.Writer
+	if p.NeedBuffer() {
+		bw = bpool.GetBw(bpool.Block4k)
+		bw.Reset(&out)
+		cw.Reset(bw)
+	} else {
+		cw.Reset(&out)
+	}
+	in, err := bpool.Copy(cw, job.src)
+	if err == nil {
+		err = cw.Close()
+	}
+	// before bw goes back, cw writes to it.
+	putWriter(p, cw, err == nil)
+	if err == nil && bw != nil {
+		err = bw.Flush()
+	}
+	if bw != nil {
+		bpool.PutBw(bw)
+	}
+	if err == nil {
+		RecordBytes(p, in, out.n)
+	}
+	_ = job.pw.CloseWithError(err)
+}
@@ -0,0 +1,106 @@
+package compress
+
+import (
+	"context"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/newacorn/goutils/bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestWorkers(t *testing.T) {
+	src := strings.Repeat("batch export row,", 20000)
+	w := NewWorkers(WorkerOptions{Workers: 2, QueueDepth: 8, PipeSize: 16 << 10})
+	wg := sync.WaitGroup{}
+	for i, order := range []Order{Gzip, Deflate, Zstd, Br, S2, Gzip} {
+		pr, err := w.Submit(context.Background(), strings.NewReader(src), order, -1)
+		assert.NoErr(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			compressed, err := io.ReadAll(pr)
+			assert.NoErr(t, err, i)
+			d, err := AppendDecompressed(nil, compressed, order, 0)
+			assert.NoErr(t, err, i)
+			assert.Eq(t, src, string(d), i)
+		}()
+	}
+	wg.Wait()
+	// a reader closed early does not hold the worker.
+	pr, err := w.Submit(context.Background(), strings.NewReader(src), Zstd, -1)
+	assert.NoErr(t, err)
+	assert.NoErr(t, pr.Close())
+	// a failed source does not leave its stream in the pooled writer.
+	one := NewWorkers(WorkerOptions{Workers: 1})
+	for _, order := range []Order{Gzip, Zstd, Br} {
+		failing := io.MultiReader(strings.NewReader(src[:5000]), iotest.ErrReader(io.ErrUnexpectedEOF))
+		pr, err = one.Submit(context.Background(), failing, order, -1)
+		assert.NoErr(t, err)
+		_, err = io.ReadAll(pr)
+		assert.ErrIs(t, err, io.ErrUnexpectedEOF)
+		pr, err = one.Submit(context.Background(), strings.NewReader("tail"), order, -1)
+		assert.NoErr(t, err)
+		compressed, err := io.ReadAll(pr)
+		assert.NoErr(t, err)
+		d, err := AppendDecompressed(nil, compressed, order, 0)
+		assert.NoErr(t, err)
+		assert.Eq(t, "tail", string(d))
+	}
+	assert.NoErr(t, one.Close())
+	//
+	_, err = w.Submit(context.Background(), strings.NewReader(src), "lzw", -1)
+	assert.ErrIs(t, err, ErrUnsupportedOrder)
+	assert.NoErr(t, w.Close())
+	_, err = w.Submit(context.Background(), strings.NewReader(src), Gzip, -1)
+	assert.ErrIs(t, err, ErrWorkersClosed)
+	assert.ErrIs(t, w.Close(), ErrWorkersClosed)
+}
+
+// blockedReader blocks until release is closed.
+type blockedReader struct {
+	release chan struct{}
+}
+
+func (b blockedReader) Read([]byte) (int, error) {
+	<-b.release
+	return 0, io.EOF
+}
+
+func TestWorkersBackpressure(t *testing.T) {
+	src := blockedReader{release: make(chan struct{})}
+	w := NewWorkers(WorkerOptions{Workers: 1, QueueDepth: 1})
+	first, err := w.Submit(context.Background(), src, Gzip, -1)
+	assert.NoErr(t, err)
+	// the worker picks the first job, the second one waits in the queue.
+	for w.Queued() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second, err := w.Submit(context.Background(), src, Gzip, -1)
+	assert.NoErr(t, err)
+	assert.Eq(t, 1, w.Queued())
+	_, err = w.Submit(context.Background(), src, Gzip, -1)
+	assert.ErrIs(t, err, ErrQueueFull)
+	//
+	w.opts.Block = true
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = w.Submit(ctx, src, Gzip, -1)
+	assert.ErrIs(t, err, context.DeadlineExceeded)
+	//
+	close(src.release)
+	for _, pr := range []io.Reader{first, second} {
+		compressed, err := io.ReadAll(pr)
+		assert.NoErr(t, err)
+		r, err := NewReader(Gzip, bytes.NewBuffer(compressed))
+		assert.NoErr(t, err)
+		rs, err := io.ReadAll(r)
+		assert.NoErr(t, err)
+		assert.Empty(t, rs)
+		assert.NoErr(t, r.Close())
+	}
+	assert.NoErr(t, w.Close())
+}
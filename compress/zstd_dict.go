@@ -0,0 +1,233 @@
+package compress
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"hash/crc32"
+	"io"
+	"slices"
+	"sync"
+)
+
+// DefaultZstdDictSize history size trained by TrainZstdDict when MaxSize is unset.
+const DefaultZstdDictSize = 32 << 10
+
+// ErrNoSamples TrainZstdDict got nothing to learn from.
+var ErrNoSamples = errors.New("compress: no samples to train a dictionary")
+
+const (
+	// dictDmer length of the substrings counted by the trainer.
+	dictDmer = 8
+	// dictSegment length of the pieces of samples making the history.
+	dictSegment = 256
+)
+
+// dictPick a segment of the history and its score when picked.
+type dictPick struct {
+	seg   []byte
+	score int
+}
+
+// ZstdDictOptions configures TrainZstdDict.
+type ZstdDictOptions struct {
+	// ID of the dictionary, 0 derives one from the history.
+	ID uint32
+	// MaxSize maximum history size, 0 means DefaultZstdDictSize.
+	MaxSize int
+	// Level the encoder level the tables are tuned for, 0 means
+	// zstd.SpeedBestCompression.
+	Level zstd.EncoderLevel
+}
+
+// TrainZstdDict builds a zstd dictionary out of samples that look like the
+// payloads to be compressed, e.g. API responses.
+//
+// The history is made of the sample segments with the most common substrings,
+// picked like zstd's COVER trainer: the segments are split into epochs, each
+// epoch contributes its best segment and substrings already in the history no
+// longer count. The picked segments are ordered by score, the best last, close
+// to the data. When every sample fits they make the history as they are.
+func TrainZstdDict(samples [][]byte, opts ZstdDictOptions) ([]byte, error) {
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultZstdDictSize
+	}
+	freq := make(map[uint64]int)
+	var segments [][]byte
+	total := 0
+	for _, sample := range samples {
+		for i := 0; i+dictDmer <= len(sample); i++ {
+			freq[binary.LittleEndian.Uint64(sample[i:])]++
+		}
+		for i := 0; i < len(sample); i += dictSegment / 2 {
+			end := min(i+dictSegment, len(sample))
+			if end-i >= dictDmer {
+				segments = append(segments, sample[i:end])
+			}
+			if end == len(sample) {
+				break
+			}
+		}
+		total += len(sample)
+	}
+	if len(segments) == 0 {
+		return nil, ErrNoSamples
+	}
+	var picked []dictPick
+	size := 0
+	if total <= maxSize {
+		// everything fits, no need to choose.
+		for _, sample := range samples {
+			picked = append(picked, dictPick{seg: sample})
+		}
+		size = total
+	} else {
+		epochs := max(maxSize/dictSegment, 1)
+		epochLen := max(len(segments)/epochs, 1)
+		for start := 0; start < len(segments) && size < maxSize; start += epochLen {
+			best, bestScore := -1, 0
+			for i := start; i < min(start+epochLen, len(segments)); i++ {
+				s := segments[i]
+				score := 0
+				for j := 0; j+dictDmer <= len(s); j++ {
+					score += freq[binary.LittleEndian.Uint64(s[j:])]
+				}
+				if score > bestScore {
+					best, bestScore = i, score
+				}
+			}
+			if best < 0 {
+				continue
+			}
+			s := segments[best]
+			for j := 0; j+dictDmer <= len(s); j++ {
+				freq[binary.LittleEndian.Uint64(s[j:])] = 0
+			}
+			if size+len(s) > maxSize {
+				s = s[:maxSize-size]
+			}
+			picked = append(picked, dictPick{seg: s, score: bestScore})
+			size += len(s)
+		}
+		slices.SortStableFunc(picked, func(a, b dictPick) int {
+			return cmp.Compare(a.score, b.score)
+		})
+	}
+	history := make([]byte, 0, size)
+	for _, p := range picked {
+		history = append(history, p.seg...)
+	}
+	if len(history) < dictDmer {
+		return nil, ErrNoSamples
+	}
+	id := opts.ID
+	if id == 0 {
+		// ids below 32768 are reserved for registered dictionaries.
+		id = 32768 + crc32.ChecksumIEEE(history)%(1<<31-32768)
+	}
+	return zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: samples,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+		Level:    opts.Level,
+	})
+}
+
+// ZstdDictPools encoder and decoder pools built with one dictionary. The
+// embedded PoolContainer is used like DefaultZstdCompressPools.
+type ZstdDictPools struct {
+	*PoolContainer[*zstd.Encoder]
+	Readers ReaderPool[ZstdReader]
+	id      uint32
+	dict    []byte
+}
+
+// NewZstdDictPools dict must be in the zstd dictionary format, as produced by
+// TrainZstdDict or "zstd --train".
+func NewZstdDictPools(dict []byte) (*ZstdDictPools, error) {
+	d, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return nil, err
+	}
+	z := &ZstdDictPools{
+		PoolContainer: &PoolContainer[*zstd.Encoder]{
+			defaultLevel: int(zstd.SpeedDefault),
+			offset:       0,
+			poolsInit:    zstdPoolsInit(zstd.WithEncoderDict(dict)),
+		},
+		id:   d.ID(),
+		dict: dict,
+	}
+	z.init()
+	z.Readers.New = func() interface{} {
+		r, _ := zstd.NewReader(nil, zstd.WithDecoderDicts(dict))
+		return ZstdReader{Decoder: r}
+	}
+	return z, nil
+}
+
+// ID the dictionary ID written in the frames.
+func (z *ZstdDictPools) ID() uint32 {
+	return z.id
+}
+
+// Dict the dictionary in zstd format.
+func (z *ZstdDictPools) Dict() []byte {
+	return z.dict
+}
+
+// NewReader is the NewReader of Zstd using the pooled decoders of z.
+func (z *ZstdDictPools) NewReader(src io.Reader) (io.ReadCloser, error) {
+	return newZstdReader(&z.Readers, src)
+}
+
+// ZstdDicts dictionary pools by dictionary ID. The zero value is ready to use.
+type ZstdDicts struct {
+	mu    sync.RWMutex
+	pools map[uint32]*ZstdDictPools
+}
+
+// DefaultZstdDicts process wide registry of dictionaries.
+var DefaultZstdDicts ZstdDicts
+
+// Register makes pools for dict, replacing those of a dictionary with the same ID.
+func (z *ZstdDicts) Register(dict []byte) (*ZstdDictPools, error) {
+	p, err := NewZstdDictPools(dict)
+	if err != nil {
+		return nil, err
+	}
+	z.mu.Lock()
+	if z.pools == nil {
+		z.pools = make(map[uint32]*ZstdDictPools)
+	}
+	z.pools[p.id] = p
+	z.mu.Unlock()
+	return p, nil
+}
+
+// Get the pools of dictionary id, nil when not registered.
+func (z *ZstdDicts) Get(id uint32) *ZstdDictPools {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.pools[id]
+}
+
+// Unregister forgets dictionary id.
+func (z *ZstdDicts) Unregister(id uint32) {
+	z.mu.Lock()
+	delete(z.pools, id)
+	z.mu.Unlock()
+}
+
+// ZstdFrameDictID the dictionary ID in the header of the zstd frame at the
+// start of head, 0 when the frame uses no dictionary.
+func ZstdFrameDictID(head []byte) (uint32, error) {
+	var h zstd.Header
+	if err := h.Decode(head); err != nil {
+		return 0, err
+	}
+	return h.DictionaryID, nil
+}
@@ -0,0 +1,92 @@
+package compress
+
+import (
+	"fmt"
+	"github.com/gookit/goutil/testutil/assert"
+	"github.com/klauspost/compress/zstd"
+	"github.com/newacorn/goutils/bytes"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func jsonSamples(n int) [][]byte {
+	r := rand.New(rand.NewSource(1))
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = []byte(fmt.Sprintf(`{"id":%d,"user":{"name":"user-%d","email":"user%d@example.com","active":%t},`+
+			`"roles":["reader","writer"],"balance":%d.%02d,"created_at":"2024-10-%02dT12:%02d:00Z","tags":{"plan":"premium","region":"eu-west-1"}}`,
+			r.Intn(1e6), r.Intn(1e4), r.Intn(1e4), r.Intn(2) == 0, r.Intn(1e5), r.Intn(100), r.Intn(28)+1, r.Intn(60)))
+	}
+	return samples
+}
+
+func TestTrainZstdDict(t *testing.T) {
+	samples := jsonSamples(500)
+	dict, err := TrainZstdDict(samples, ZstdDictOptions{MaxSize: 4 << 10})
+	assert.NoErr(t, err)
+	pools, err := DefaultZstdDicts.Register(dict)
+	assert.NoErr(t, err)
+	defer DefaultZstdDicts.Unregister(pools.ID())
+	assert.Gte(t, pools.ID(), uint32(32768))
+	assert.Eq(t, pools, DefaultZstdDicts.Get(pools.ID()))
+	//
+	payload := jsonSamples(501)[500]
+	plain := compressForTest(t, Zstd, int(zstd.SpeedDefault), payload)
+	//
+	p := pools.Pool(int(zstd.SpeedDefault))
+	w := p.Get()
+	buf := bytes.Buffer{}
+	w.Reset(&buf)
+	_, err = w.Write(payload)
+	assert.NoErr(t, err)
+	assert.NoErr(t, w.Close())
+	p.Put(w)
+	withDict := buf.Bytes()
+	t.Logf("payload %d, zstd %d, zstd with dictionary %d", len(payload), len(plain), len(withDict))
+	assert.Lt(t, len(withDict), len(plain))
+	//
+	id, err := ZstdFrameDictID(withDict)
+	assert.NoErr(t, err)
+	assert.Eq(t, pools.ID(), id)
+	for i := 0; i < 3; i++ {
+		r, err := DefaultZstdDicts.Get(id).NewReader(bytes.NewBuffer(withDict))
+		assert.NoErr(t, err)
+		rs, err := io.ReadAll(r)
+		assert.NoErr(t, err)
+		assert.Eq(t, payload, rs)
+		assert.NoErr(t, r.Close())
+	}
+	// the plain decoders can not read it.
+	r, err := NewReader(Zstd, bytes.NewBuffer(withDict))
+	if err == nil {
+		_, err = io.ReadAll(r)
+		assert.Err(t, err)
+		_ = r.Close()
+	}
+}
+
+func TestTrainZstdDictBestLast(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	hot := []byte(strings.Repeat("hot-path ", 60))
+	samples := make([][]byte, 100)
+	for i := range samples {
+		samples[i] = make([]byte, 512)
+		r.Read(samples[i])
+		if i >= 60 && i%3 == 0 {
+			samples[i] = append(samples[i], hot...)
+		}
+	}
+	dict, err := TrainZstdDict(samples, ZstdDictOptions{MaxSize: 2 << 10})
+	assert.NoErr(t, err)
+	// the history closes the dictionary, its best segment is made of hot.
+	assert.Contains(t, string(hot), string(dict[len(dict)-dictDmer*8:]))
+}
+
+func TestTrainZstdDictNoSamples(t *testing.T) {
+	_, err := TrainZstdDict(nil, ZstdDictOptions{})
+	assert.ErrIs(t, err, ErrNoSamples)
+	_, err = NewZstdDictPools([]byte("not a dictionary"))
+	assert.Err(t, err)
+}